@@ -0,0 +1,81 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// SecretSource returns a secret, such as an API key. It is called for every request,
+// so it should cache secrets that are expensive to get.
+type SecretSource func(ctx context.Context) (string, error)
+
+// SecretFromEnv returns a SecretSource that reads the secret from the environment variable.
+func SecretFromEnv(name string) SecretSource {
+	return func(ctx context.Context) (string, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok || v == "" {
+			return "", fmt.Errorf("httpClient: environment variable %s is not set", name)
+		}
+		return v, nil
+	}
+}
+
+// APIKey configures the API key sent with the calls; see WithAPIKey.
+type APIKey struct {
+	// Header is the header carrying the key, such as "X-API-Key".
+	Header string
+
+	// Query is the query parameter carrying the key, such as "key", if Header is not set.
+	Query string
+
+	// Source returns the key, such as SecretFromEnv("MAPS_API_KEY").
+	Source SecretSource
+}
+
+// WithAPIKey sends an API key with every request, in a header or a query parameter. The key is added to the
+// request right before it is sent by the transport, so it doesn't appear in the logs, spans, HAR entries or
+// archived calls, and the header or query parameter is redacted if it is already set. If the key can't be
+// found, the call fails with the error. WithAPIKey can be combined with WithCredentials, and has no effect
+// with WithDoer.
+func WithAPIKey(k APIKey) Option {
+	return func(cfg *config) {
+		cfg.apiKey = &k
+	}
+}
+
+// Credentials returns the header with the API key. An API key sent in a query parameter has no headers.
+func (k *APIKey) Credentials(req *http.Request) (http.Header, error) {
+	if k.Header == "" {
+		return nil, nil
+	}
+	key, err := k.Source(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	return http.Header{http.CanonicalHeaderKey(k.Header): {key}}, nil
+}
+
+// apiKeyTransport adds the API key to the query of the requests
+type apiKeyTransport struct {
+	key  *APIKey
+	base http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := t.key.Source(req.Context())
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	q := r.URL.Query()
+	q.Set(t.key.Query, key)
+	r.URL.RawQuery = q.Encode()
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
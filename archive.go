@@ -0,0 +1,231 @@
+package httpClient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ArchiveSink stores the batches of calls captured by an Archiver. GCSSink stores them in Cloud Storage;
+// implement ArchiveSink to store them elsewhere.
+type ArchiveSink interface {
+	// Store stores a batch under the name, such as 2024/01/31/150405.000-1a2b3c4d.jsonl.gz.
+	// The data is gzip-compressed JSON lines, one captured call per line.
+	Store(ctx context.Context, name string, data []byte) error
+}
+
+// ArchiveConfig configures an Archiver.
+type ArchiveConfig struct {
+	// SampleRate is the fraction of the calls captured, between 0 and 1.
+	SampleRate float64
+
+	// MaxBody is the number of bytes of the request and response bodies kept. Defaults to DefaultHARMaxBody.
+	MaxBody int
+
+	// BatchSize is the number of calls stored together. Defaults to 100.
+	BatchSize int
+
+	// FlushInterval is the longest a captured call waits before it is stored. Defaults to one minute.
+	FlushInterval time.Duration
+
+	// QueueSize is the number of captured calls waiting to be stored; calls captured while the queue is full
+	// are dropped. Defaults to 1000.
+	QueueSize int
+
+	// Logger logs the errors storing the batches. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// Archiver captures a sample of the calls, with their headers and truncated bodies, and stores them in batches
+// in an ArchiveSink in the background, for audits. Each captured call is a HAR entry, with the API name and
+// the trace ID of the call, redacted with the Redactor of the call; see WithRedactor.
+//
+// Create an Archiver with NewArchiver, pass it to WithArchive, and Close it when the program exits.
+// An Archiver is safe for concurrent use by multiple goroutines.
+type Archiver struct {
+	sink ArchiveSink
+	cfg  ArchiveConfig
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan *archiveRecord
+	done   chan struct{}
+}
+
+// archiveRecord is a captured call, as stored
+type archiveRecord struct {
+	APIName string    `json:"apiName"`
+	TraceID string    `json:"traceId,omitempty"`
+	Entry   *harEntry `json:"entry"`
+}
+
+// NewArchiver returns an Archiver that stores the captured calls in the sink, and starts storing them.
+func NewArchiver(sink ArchiveSink, c ArchiveConfig) *Archiver {
+	if c.MaxBody <= 0 {
+		c.MaxBody = DefaultHARMaxBody
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = time.Minute
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 1000
+	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	a := &Archiver{
+		sink:  sink,
+		cfg:   c,
+		queue: make(chan *archiveRecord, c.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// WithArchive captures a sample of the attempts of the calls with the archiver.
+func WithArchive(a *Archiver) Option {
+	return func(cfg *config) {
+		cfg.archive = a
+	}
+}
+
+// Close stores the calls captured so far and stops the archiver. Calls captured after Close are dropped.
+func (a *Archiver) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// capture starts capturing an attempt of the call to the API, redacted with r, or returns nil if it is not sampled.
+func (a *Archiver) capture(req *http.Request, apiName string, r *Redactor, ph *phases) *harCapture {
+	if randFloat64() >= a.cfg.SampleRate {
+		return nil
+	}
+	return newHARCapture(req, a.cfg.MaxBody, r, func(e *harEntry) {
+		a.enqueue(&archiveRecord{APIName: apiName, TraceID: ph.traceID(), Entry: e})
+	})
+}
+
+// enqueue queues the record to be stored, unless the queue is full or the archiver is closed.
+func (a *Archiver) enqueue(r *archiveRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.queue <- r:
+	default:
+	}
+}
+
+// run stores the queued records in batches, until the archiver is closed.
+func (a *Archiver) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []*archiveRecord
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := a.store(batch); err != nil {
+			a.cfg.Logger.Warn("httpClient: storing archived calls", "calls", len(batch), "error", err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case r, ok := <-a.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= a.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// store compresses the batch and stores it in the sink.
+func (a *Archiver) store(batch []*archiveRecord) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, r := range batch {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%08x.jsonl.gz", now.Format("2006/01/02/150405.000"), uint32(randFloat64()*(1<<32)))
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.FlushInterval)
+	defer cancel()
+	return a.sink.Store(ctx, name, buf.Bytes())
+}
+
+// GCSSink stores the archived calls in a Cloud Storage bucket, using the JSON API.
+type GCSSink struct {
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Prefix is prefixed to the object names, such as "audit/".
+	Prefix string
+
+	// Client makes the calls to Cloud Storage. It must authenticate the calls,
+	// for example with a transport from golang.org/x/oauth2/google.
+	Client *Client
+}
+
+// Store uploads the data as an object.
+func (s *GCSSink) Store(ctx context.Context, name string, data []byte) error {
+	u := "https://storage.googleapis.com/upload/storage/v1/b/" + url.PathEscape(s.Bucket) +
+		"/o?uploadType=media&name=" + url.QueryEscape(s.Prefix+name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+
+	// An error that only reports failing to record metrics doesn't make the upload fail
+	resp, err := s.Client.Do(req, WithAPIName("storage.objects.insert"))
+	if resp == nil || errors.Is(err, ErrHTTP) {
+		return err
+	}
+	defer discard(resp)
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	return nil
+}
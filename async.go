@@ -0,0 +1,82 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definition for metrics dropped because the queue of WithAsyncMetrics was full
+	metricsDropped = stats.Int64("http_outbound_metrics_dropped", "Metrics of calls to the external HTTP API dropped because the recording queue was full", stats.UnitDimensionless)
+)
+
+func init() {
+	registerCounterMetric(metricsDropped, []tag.Key{APINameTag})
+}
+
+// WithAsyncMetrics records the latency and counter metrics of the calls in a background goroutine, rather than
+// in Client.Do, so that the call doesn't wait on the stats pipeline. The metrics are queued, up to queueSize;
+// when the queue is full, the metrics are dropped and counted in the http_outbound_metrics_dropped metric.
+//
+// Since the metrics are recorded after Client.Do returns, errors recording them are logged rather than returned.
+// Pass the option to New: the queue and goroutine are shared by every client created with the same Option value.
+// If queueSize is negative, Client.Do returns an error.
+func WithAsyncMetrics(queueSize int) Option {
+	if queueSize < 0 {
+		return func(cfg *config) {
+			cfg.err = fmt.Errorf("httpClient: invalid metrics queue of %d", queueSize)
+		}
+	}
+	a := &asyncRecorder{queue: make(chan asyncSample, queueSize)}
+	return func(cfg *config) {
+		cfg.async = a
+	}
+}
+
+// asyncSample is metrics queued for recording
+type asyncSample struct {
+	record func() error
+	log    *slog.Logger
+}
+
+// asyncRecorder records metrics in a background goroutine, started with the first sample
+type asyncRecorder struct {
+	queue chan asyncSample
+	start sync.Once
+}
+
+// enqueue queues record, or records that it was dropped if the queue is full.
+func (a *asyncRecorder) enqueue(ctx context.Context, apiName string, log *slog.Logger, record func() error) error {
+	a.start.Do(func() { go a.run() })
+	select {
+	case a.queue <- asyncSample{record: record, log: log}:
+		return nil
+	default:
+		return stats.RecordWithTags(ctx,
+			[]tag.Mutator{tag.Upsert(APINameTag, apiName)},
+			metricsDropped.M(1))
+	}
+}
+
+// run records the queued metrics.
+func (a *asyncRecorder) run() {
+	for s := range a.queue {
+		if err := s.record(); err != nil {
+			s.log.Warn("httpClient: recording metrics", "error", err)
+		}
+	}
+}
+
+// emit records the metrics with record, right away or in the background if WithAsyncMetrics is set.
+func (cl *call) emit(ctx context.Context, record func() error) {
+	if cl.cfg.async == nil {
+		cl.metricError(record())
+		return
+	}
+	cl.metricError(cl.cfg.async.enqueue(ctx, cl.cfg.apiName, cl.cfg.log(), record))
+}
@@ -0,0 +1,68 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenRefreshWindow is how long before they expire tokens are refreshed, so that a token doesn't expire
+// while a call is on its way
+const tokenRefreshWindow = time.Minute
+
+// WithTokenSource authenticates the calls with an OAuth2 bearer token from the token source, such as one from
+// golang.org/x/oauth2/google or golang.org/x/oauth2/clientcredentials. The token is cached, and refreshed
+// a minute before it expires. A fresh token is fetched for each attempt if needed, so a retry isn't sent
+// with an expired token. If the API responds 401 Unauthorized, such as when the token was revoked, the cached
+// token is discarded and the call is retried once with a new token; see WithCredentials.
+//
+// Pass the option to New: the token is cached across every client created with the same Option value.
+func WithTokenSource(ts oauth2.TokenSource) Option {
+	return WithCredentials(&tokenCache{source: ts})
+}
+
+// tokenCache caches the token of a token source until it is about to expire or is refreshed
+type tokenCache struct {
+	source oauth2.TokenSource
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// get returns the cached token, or a new one if it is about to expire.
+func (c *tokenCache) get() (*oauth2.Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != nil && (c.token.Expiry.IsZero() || time.Until(c.token.Expiry) > tokenRefreshWindow) {
+		return c.token, nil
+	}
+	t, err := c.source.Token()
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: getting OAuth2 token: %w", err)
+	}
+	c.token = t
+	return t, nil
+}
+
+func (c *tokenCache) Credentials(req *http.Request) (http.Header, error) {
+	t, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	return http.Header{"Authorization": {t.Type() + " " + t.AccessToken}}, nil
+}
+
+// Refresh discards the cached token if the request was sent with it, so that the retry gets a new one.
+func (c *tokenCache) Refresh(ctx context.Context, resp *http.Response) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != nil && resp.Request != nil &&
+		resp.Request.Header.Get("Authorization") == c.token.Type()+" "+c.token.AccessToken {
+		c.token = nil
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package httpClient
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"go.opencensus.io/plugin/ochttp/propagation/b3"
+	"go.opencensus.io/trace"
+)
+
+// B3SingleHeader is the header of the single-header B3 format.
+const B3SingleHeader = "b3"
+
+// B3Format propagates the trace context in the B3 format of Zipkin, for services behind Zipkin or Istio.
+// Use it with WithPropagation, for a client or, with a Registry, for one API:
+//
+//	client := httpClient.New(httpClient.WithPropagation(&httpClient.B3Format{SingleHeader: true}))
+//
+// The trace context is read from either format on incoming requests.
+type B3Format struct {
+	// SingleHeader sends the trace context in the single b3 header, rather than the X-B3-TraceId,
+	// X-B3-SpanId and X-B3-Sampled headers.
+	SingleHeader bool
+}
+
+// SpanContextFromRequest reads the trace context from the b3 header, or from the X-B3 headers if it isn't set.
+func (f *B3Format) SpanContextFromRequest(req *http.Request) (sc trace.SpanContext, ok bool) {
+	h := req.Header.Get(B3SingleHeader)
+	if h == "" {
+		return (&b3.HTTPFormat{}).SpanContextFromRequest(req)
+	}
+
+	// traceid-spanid[-sampled[-parentspanid]]; a lone sampling decision carries no context
+	parts := strings.Split(h, "-")
+	if len(parts) < 2 {
+		return trace.SpanContext{}, false
+	}
+	tid, ok := b3.ParseTraceID(parts[0])
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+	sid, ok := b3.ParseSpanID(parts[1])
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+	sc = trace.SpanContext{TraceID: tid, SpanID: sid}
+	if len(parts) > 2 && (parts[2] == "1" || parts[2] == "d") {
+		sc.TraceOptions = 1
+	}
+	return sc, true
+}
+
+// SpanContextToRequest writes the trace context to the request.
+func (f *B3Format) SpanContextToRequest(sc trace.SpanContext, req *http.Request) {
+	if !f.SingleHeader {
+		(&b3.HTTPFormat{}).SpanContextToRequest(sc, req)
+		return
+	}
+	sampled := "0"
+	if sc.IsSampled() {
+		sampled = "1"
+	}
+	req.Header.Set(B3SingleHeader, hex.EncodeToString(sc.TraceID[:])+"-"+hex.EncodeToString(sc.SpanID[:])+"-"+sampled)
+}
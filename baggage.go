@@ -0,0 +1,68 @@
+package httpClient
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// WithBaggage adds a member to the W3C baggage sent with the request, to pass context such as the tenant ID
+// or the origin of the request on to downstream services. The baggage of the request context, set with
+// baggage.ContextWithBaggage, is forwarded too. The baggage header is sent whatever the WithTelemetry mode.
+// If the key is not a valid baggage key, Client.Do returns the error.
+func WithBaggage(key string, value string) Option {
+	return func(cfg *config) {
+		m, err := baggage.NewMemberRaw(key, value)
+		if err != nil {
+			cfg.err = fmt.Errorf("httpClient: invalid baggage member %q: %w", key, err)
+			return
+		}
+		cfg.baggage = append(cfg.baggage, m)
+	}
+}
+
+// WithTagBaggage forwards the values of the OpenCensus tags of the request context as members of the
+// W3C baggage sent with the request, named after the tag keys.
+func WithTagBaggage(keys ...tag.Key) Option {
+	return func(cfg *config) {
+		cfg.tagBaggage = append(cfg.tagBaggage, keys...)
+	}
+}
+
+// withBaggage returns the request with the baggage header, if there is baggage to send.
+func (cfg *config) withBaggage(req *http.Request) (*http.Request, error) {
+	ctx := req.Context()
+	b := baggage.FromContext(ctx)
+	if len(cfg.baggage) == 0 && len(cfg.tagBaggage) == 0 && b.Len() == 0 {
+		return req, nil
+	}
+
+	members := cfg.baggage
+	if tags := tag.FromContext(ctx); tags != nil {
+		for _, k := range cfg.tagBaggage {
+			v, ok := tags.Value(k)
+			if !ok {
+				continue
+			}
+			m, err := baggage.NewMemberRaw(k.Name(), v)
+			if err != nil {
+				return nil, fmt.Errorf("httpClient: invalid baggage member %q: %w", k.Name(), err)
+			}
+			members = append(members[:len(members):len(members)], m)
+		}
+	}
+	for _, m := range members {
+		var err error
+		if b, err = b.SetMember(m); err != nil {
+			return nil, fmt.Errorf("httpClient: adding baggage member %q: %w", m.Key(), err)
+		}
+	}
+
+	ctx = baggage.ContextWithBaggage(ctx, b)
+	req = req.Clone(ctx)
+	propagation.Baggage{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, nil
+}
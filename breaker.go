@@ -0,0 +1,228 @@
+package httpClient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// ErrCircuitOpen is returned when the circuit breaker for an API is open and the call was not made.
+var ErrCircuitOpen = errors.New("httpClient: circuit breaker is open")
+
+var (
+	// OpenCensus metric definition for circuit breaker state transitions
+	circuitBreakerTransitions = stats.Int64("http_outbound_circuit_breaker_transitions", "Circuit breaker state transitions for the external HTTP API", stats.UnitDimensionless)
+
+	// CircuitStateTag is the state a circuit breaker moved to: closed, open or half_open.
+	CircuitStateTag = tag.MustNewKey("circuit_breaker_state")
+)
+
+func init() {
+	registerCounterMetric(circuitBreakerTransitions, []tag.Key{APINameTag, CircuitStateTag})
+}
+
+// CircuitBreakerConfig configures a circuit breaker.
+// A breaker starts out closed and lets calls through. It trips (opens) after ConsecutiveFailures
+// failures in a row, or when the share of failed calls within Window reaches FailureRate.
+// While open, calls fail immediately with ErrCircuitOpen. After OpenTimeout the breaker
+// half-opens and lets HalfOpenProbes calls through: if they all succeed the breaker closes,
+// if any of them fails it opens again.
+type CircuitBreakerConfig struct {
+	// ConsecutiveFailures is the number of failures in a row that trips the breaker.
+	// Defaults to 5.
+	ConsecutiveFailures int
+
+	// FailureRate is the share of failed calls (0 to 1) within Window that trips the breaker.
+	// 0 turns the check off.
+	FailureRate float64
+
+	// MinRequests is the number of calls that must be made within Window before FailureRate is checked.
+	// Defaults to 20.
+	MinRequests int
+
+	// Window is the period over which the failure rate is calculated.
+	// Defaults to 1 minute.
+	Window time.Duration
+
+	// OpenTimeout is how long the breaker stays open before it lets probe calls through.
+	// Defaults to 30 seconds.
+	OpenTimeout time.Duration
+
+	// HalfOpenProbes is the number of probe calls let through, and that must succeed, to close the breaker.
+	// Defaults to 1.
+	HalfOpenProbes int
+
+	// IsFailure reports whether a call failed. By default a call failed if it returned an error or a 5xx status.
+	IsFailure func(resp *http.Response, err error) bool
+}
+
+// WithCircuitBreaker adds a circuit breaker for each API called with the client.
+// Breakers are kept per API name, or per host for calls made without an API name.
+// Pass the option to New: the state of the breakers is shared by every client created with the same Option value.
+// State transitions are recorded in the http_outbound_circuit_breaker_transitions metric.
+func WithCircuitBreaker(c CircuitBreakerConfig) Option {
+	c = c.withDefaults()
+	breakers := newKeyed(func(key string) *breaker {
+		return &breaker{cfg: &c, key: key}
+	})
+	return func(cfg *config) {
+		cfg.breakers = breakers
+	}
+}
+
+func (c CircuitBreakerConfig) withDefaults() CircuitBreakerConfig {
+	if c.ConsecutiveFailures <= 0 {
+		c.ConsecutiveFailures = 5
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.Window <= 0 {
+		c.Window = time.Minute
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+	if c.HalfOpenProbes <= 0 {
+		c.HalfOpenProbes = 1
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode >= 500
+		}
+	}
+	return c
+}
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker is the circuit breaker for one key
+type breaker struct {
+	cfg *CircuitBreakerConfig
+	key string
+
+	mu          sync.Mutex
+	state       breakerState
+	consecutive int       // failures in a row
+	windowStart time.Time // start of the current failure rate window
+	requests    int       // calls in the current window
+	failures    int       // failed calls in the current window
+	openedAt    time.Time
+	probes      int // probe calls let through while half-open
+	successes   int // successful probe calls while half-open
+}
+
+// allow reports whether a call may be made. If the breaker moved to half-open, ctx is used to record the transition.
+func (b *breaker) allow(ctx context.Context) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.cfg.OpenTimeout {
+			return false
+		}
+		b.transition(ctx, stateHalfOpen)
+		fallthrough
+	case stateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// cancel gives back a call that allow let through, but that was not made.
+func (b *breaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// done records the outcome of a call that allow let through.
+func (b *breaker) done(ctx context.Context, resp *http.Response, err error) {
+	failed := b.cfg.IsFailure(resp, err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateHalfOpen:
+		if failed {
+			b.transition(ctx, stateOpen)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenProbes {
+			b.transition(ctx, stateClosed)
+		}
+	case stateClosed:
+		now := time.Now()
+		if now.Sub(b.windowStart) > b.cfg.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+		b.requests++
+		if !failed {
+			b.consecutive = 0
+			return
+		}
+		b.consecutive++
+		b.failures++
+		if b.consecutive >= b.cfg.ConsecutiveFailures ||
+			(b.cfg.FailureRate > 0 && b.requests >= b.cfg.MinRequests && float64(b.failures)/float64(b.requests) >= b.cfg.FailureRate) {
+			b.transition(ctx, stateOpen)
+		}
+	}
+	// A call that was let through before the breaker opened has nothing left to count
+}
+
+// transition moves the breaker to the state, resets the counters and records the transition.
+// The caller must hold b.mu.
+func (b *breaker) transition(ctx context.Context, to breakerState) {
+	b.state = to
+	b.consecutive, b.requests, b.failures, b.probes, b.successes = 0, 0, 0, 0, 0
+	b.windowStart = time.Now()
+	if to == stateOpen {
+		b.openedAt = time.Now()
+	}
+	// The breaker keeps working if the transition can't be recorded
+	_ = stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(APINameTag, b.key),
+			tag.Upsert(CircuitStateTag, to.String()),
+		},
+		circuitBreakerTransitions.M(1))
+}
+
+// breakerKey returns the key of the breaker used for the request: the API name, or the host.
+func breakerKey(apiName string, req *http.Request) string {
+	if apiName != "" {
+		return apiName
+	}
+	return req.URL.Host
+}
@@ -0,0 +1,105 @@
+package httpClient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definition for retries skipped because the retry budget was exhausted
+	retryBudgetExhausted = stats.Int64("http_outbound_retry_budget_exhausted", "Retries to the external HTTP API skipped because the retry budget was exhausted", stats.UnitDimensionless)
+)
+
+func init() {
+	registerCounterMetric(retryBudgetExhausted, []tag.Key{APINameTag})
+}
+
+// budgetBuckets is the number of buckets the window of a RetryBudget is divided into
+const budgetBuckets = 10
+
+// RetryBudget limits retries to a share of the request volume over a sliding window,
+// so that retries can't multiply the load on an upstream that is already failing.
+// Retries beyond the budget are skipped, and counted in the http_outbound_retry_budget_exhausted metric.
+//
+// A budget is shared by every call that uses it: give each API its own budget
+// to limit retries per API, or use one budget for all of them to limit retries globally.
+// A RetryBudget is safe for concurrent use by multiple goroutines.
+type RetryBudget struct {
+	ratio      float64
+	minRetries int
+	bucketSize time.Duration
+
+	mu      sync.Mutex
+	buckets [budgetBuckets]budgetBucket
+}
+
+type budgetBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// NewRetryBudget returns a budget that allows retries up to ratio (for example 0.1 for 10%)
+// of the requests made within the window, plus minRetries, which lets an API with little
+// traffic retry at all.
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+	return &RetryBudget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		// A window shorter than a nanosecond per bucket would make the buckets empty
+		bucketSize: max(window/budgetBuckets, time.Nanosecond),
+	}
+}
+
+// bucket returns the bucket for the time, resetting it if it belongs to an earlier window.
+// The caller must hold b.mu.
+func (b *RetryBudget) bucket(now time.Time) *budgetBucket {
+	start := now.Truncate(b.bucketSize)
+	bk := &b.buckets[(start.UnixNano()/int64(b.bucketSize))%budgetBuckets]
+	if !bk.start.Equal(start) {
+		*bk = budgetBucket{start: start}
+	}
+	return bk
+}
+
+// recordRequest counts a request towards the budget.
+func (b *RetryBudget) recordRequest() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bucket(time.Now()).requests++
+}
+
+// tryRetry reports whether the budget allows a retry, and if so counts it.
+func (b *RetryBudget) tryRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	oldest := now.Add(-b.bucketSize * budgetBuckets)
+	var requests, retries int
+	for _, bk := range b.buckets {
+		if bk.start.After(oldest) {
+			requests += bk.requests
+			retries += bk.retries
+		}
+	}
+	if float64(retries+1) > b.ratio*float64(requests)+float64(b.minRetries) {
+		return false
+	}
+	b.bucket(now).retries++
+	return true
+}
+
+// recordBudgetExhausted records that a retry was skipped because the budget was exhausted.
+func recordBudgetExhausted(ctx context.Context, apiName string) error {
+	return stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(APINameTag, apiName)},
+		retryBudgetExhausted.M(1))
+}
@@ -0,0 +1,100 @@
+package httpClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// ErrBulkheadFull is returned when an API already has the maximum number of calls in flight
+// and the queue of waiting calls is full.
+var ErrBulkheadFull = errors.New("httpClient: bulkhead is full")
+
+var (
+	// OpenCensus metric definition for calls in flight in a bulkhead
+	bulkheadInFlight = stats.Int64("http_outbound_bulkhead_inflight", "Calls in flight to the external HTTP API, as limited by the bulkhead", stats.UnitDimensionless)
+)
+
+func init() {
+	registerGaugeMetric(bulkheadInFlight, []tag.Key{APINameTag})
+}
+
+// WithBulkhead limits the number of calls in flight to each API to maxConcurrent,
+// so that one slow API can't tie up every goroutine of the caller.
+// Up to maxQueue more calls wait for a free slot (or until their context is done);
+// calls beyond that fail immediately with ErrBulkheadFull.
+// A call holds its slot until Do returns, through all of its retries.
+// Bulkheads are kept per API name. Pass the option to New: the bulkheads are shared by every
+// client created with the same Option value.
+// The number of calls in flight is recorded in the http_outbound_bulkhead_inflight metric.
+// If maxConcurrent is not positive, or maxQueue is negative, Client.Do returns an error.
+func WithBulkhead(maxConcurrent int, maxQueue int) Option {
+	if maxConcurrent <= 0 || maxQueue < 0 {
+		return func(cfg *config) {
+			cfg.err = fmt.Errorf("httpClient: invalid bulkhead of %d calls and %d queued", maxConcurrent, maxQueue)
+		}
+	}
+	bulkheads := newKeyed(func(key string) *bulkhead {
+		return &bulkhead{apiName: key, slots: make(chan struct{}, maxConcurrent), maxQueue: maxQueue}
+	})
+	return func(cfg *config) {
+		cfg.bulkheads = bulkheads
+	}
+}
+
+// bulkhead limits the calls in flight to one API
+type bulkhead struct {
+	apiName  string
+	slots    chan struct{}
+	maxQueue int
+
+	mu     sync.Mutex
+	queued int
+}
+
+// acquire waits for a free slot. It fails with ErrBulkheadFull if the queue is full,
+// or with the context error if the context is done first.
+func (b *bulkhead) acquire(ctx context.Context) error {
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	b.mu.Lock()
+	if b.queued >= b.maxQueue {
+		b.mu.Unlock()
+		return ErrBulkheadFull
+	}
+	b.queued++
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.queued--
+		b.mu.Unlock()
+	}()
+
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire.
+func (b *bulkhead) release() {
+	<-b.slots
+}
+
+// record records the number of calls in flight.
+func (b *bulkhead) record(ctx context.Context) error {
+	return stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(APINameTag, b.apiName)},
+		bulkheadInFlight.M(int64(len(b.slots))))
+}
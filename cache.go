@@ -0,0 +1,963 @@
+package httpClient
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definitions for the effectiveness of the cache
+	cacheHits          = stats.Int64("http_outbound_cache_hits", "GET requests to the external HTTP API served from the cache without waiting for the API", stats.UnitDimensionless)
+	cacheMisses        = stats.Int64("http_outbound_cache_misses", "GET requests to the external HTTP API with no cached response to serve or revalidate", stats.UnitDimensionless)
+	cacheRevalidations = stats.Int64("http_outbound_cache_revalidations", "Conditional requests to the external HTTP API revalidating a cached response", stats.UnitDimensionless)
+	cacheEvictions     = stats.Int64("http_outbound_cache_evictions", "Cached responses of the external HTTP API removed to make room for others", stats.UnitDimensionless)
+	cacheNegativeHits  = stats.Int64("http_outbound_cache_negative_hits", "GET requests to the external HTTP API answered with a cached error response, such as 404 Not Found", stats.UnitDimensionless)
+
+	// CacheTag is the CacheHeader of a response served from the cache, CacheFresh or CacheStale.
+	// Recorded with the http_outbound_cache_hits metric.
+	CacheTag = tag.MustNewKey("cache")
+
+	// RevalidationTag tells whether a cached response was "not_modified", and served from the cache,
+	// or "modified", and fetched in full. Recorded with the http_outbound_cache_revalidations metric.
+	RevalidationTag = tag.MustNewKey("revalidation")
+)
+
+func init() {
+	registerCounterMetric(cacheHits, []tag.Key{APINameTag, VersionTag, CacheTag})
+	registerCounterMetric(cacheMisses, []tag.Key{APINameTag, VersionTag})
+	registerCounterMetric(cacheRevalidations, []tag.Key{APINameTag, VersionTag, RevalidationTag})
+	registerCounterMetric(cacheEvictions, []tag.Key{APINameTag, VersionTag})
+	registerCounterMetric(cacheNegativeHits, []tag.Key{APINameTag, VersionTag, CacheTag})
+}
+
+// CacheHeader is set on the responses served by a Cache, to tell how they were served.
+const CacheHeader = "X-Httpclient-Cache"
+
+// Values of the CacheHeader
+const (
+	// CacheFresh is a response served from the cache without calling the API.
+	CacheFresh = "fresh"
+
+	// CacheRevalidated is a cached response that the API confirmed is still current with 304 Not Modified.
+	CacheRevalidated = "revalidated"
+
+	// CacheStale is a stale response served from the cache while it is revalidated in the background,
+	// or because the API failed; see CacheConfig.StaleWhileRevalidate and CacheConfig.StaleIfError.
+	CacheStale = "stale"
+)
+
+// CacheConfig configures a Cache.
+type CacheConfig struct {
+	// MaxEntries is the number of responses kept; the least recently used response is dropped to make room.
+	// Defaults to 1000.
+	MaxEntries int
+
+	// MaxBody is the size of the largest response body cached, in bytes. Defaults to 1 MiB.
+	MaxBody int64
+
+	// Revalidate revalidates the cached responses that have an ETag or Last-Modified date on every request,
+	// whatever their lifetime, so that the responses are always current but the body is only sent when it
+	// changed. See WithConditionalRequests.
+	Revalidate bool
+
+	// TTL, if set, caches the successful responses to GET requests for TTL, ignoring the Cache-Control and
+	// Expires headers of the API, for APIs that don't send them. Responses with Cache-Control: no-store are
+	// still not cached. See WithCache.
+	TTL time.Duration
+
+	// StaleWhileRevalidate is how long after they become stale the responses are served from the cache while
+	// they are revalidated in the background, so that the callers never wait for the API, unless the response
+	// has a stale-while-revalidate directive (RFC 5861). Responses with must-revalidate or no-cache are never
+	// served stale.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError is how long after they become stale the responses are served from the cache when the API
+	// fails, with a transport error or a 500, 502, 503 or 504 response, unless the response has a stale-if-error
+	// directive (RFC 5861).
+	StaleIfError time.Duration
+
+	// Dir, if set, stores the responses in files in the directory rather than in memory, so that they survive
+	// restarts, and are shared by the processes using the directory, such as the instances of a Cloud Run service
+	// with the same volume mounted. Each file is written in full before it replaces the previous response, so a
+	// crash never leaves a partly written response. MaxEntries is ignored.
+	Dir string
+
+	// MaxDiskSize is the size of the files in Dir, in bytes; the least recently used responses are removed
+	// to make room. Defaults to DefaultDiskCacheSize.
+	MaxDiskSize int64
+
+	// Store, if set, stores the responses in the store rather than in memory or in Dir, such as a
+	// RedisCacheStore shared by the instances of a service, so that they don't each call the API to fill
+	// their own cache. MaxEntries, Dir and MaxDiskSize are ignored, and the store evicts the responses by its
+	// own policy, which the http_outbound_cache_evictions metric doesn't count.
+	Store CacheStore
+
+	// NegativeTTL, if set, caches the responses with one of the NegativeStatuses for NegativeTTL, whatever
+	// their cache headers, so that callers asking again and again for resources that don't exist don't
+	// hammer the API. Keep it short, as a resource created meanwhile is reported missing until it expires.
+	// The responses are counted in the http_outbound_cache_negative_hits metric rather than in
+	// http_outbound_cache_hits.
+	NegativeTTL time.Duration
+
+	// NegativeStatuses are the status codes of the responses cached for NegativeTTL. Defaults to 404 Not Found
+	// and 410 Gone.
+	NegativeStatuses []int
+
+	// KeyHeaders are the request headers whose values are part of the cache key, in addition to the URL,
+	// for APIs whose responses depend on headers they don't list in their Vary header, such as "Accept-Language",
+	// or "Authorization", to keep the responses of different users apart. The values are hashed in the keys,
+	// so credentials are not stored.
+	KeyHeaders []string
+}
+
+// Cache is an HTTP cache of the responses of an API, following RFC 7234 as a private cache, so that repeated GETs
+// to slowly-changing resources, such as configuration or catalogs, are served locally:
+//
+//   - the responses to GET requests are stored if their Cache-Control and Expires headers allow it, and served
+//     while they are fresh; responses with a Last-Modified date but no explicit lifetime are fresh for 10% of
+//     their age, up to a day
+//   - stale responses with an ETag or Last-Modified date are revalidated with a conditional request; a 304 Not
+//     Modified response refreshes the cached response, which is served. The conditional requests are counted
+//     in the http_outbound_cache_revalidations metric, by result. A 304 to a conditional request of the
+//     caller is returned as it is, and refreshes the cached response if it has the same validators
+//   - the Cache-Control no-store, no-cache, max-age, min-fresh and only-if-cached directives of the requests are
+//     honored, and a successful POST, PUT, PATCH or DELETE to a URL removes the cached response of the URL
+//   - the responses that vary with the Vary header are cached per variant, and only served to requests with the
+//     same values of the headers, so that responses per user or per locale are not mixed; CacheConfig.KeyHeaders
+//     does the same for the APIs that don't send Vary
+//   - within the stale-while-revalidate window of RFC 5861, a stale response is served at once and revalidated
+//     in the background; within the stale-if-error window, it is served when the API fails. See
+//     CacheConfig.StaleWhileRevalidate and CacheConfig.StaleIfError
+//
+// The effectiveness of the cache is recorded, by API, in the http_outbound_cache_hits metric, for the responses
+// served without waiting for the API, by CacheTag; http_outbound_cache_misses, for the GET requests sent with no
+// cached response to revalidate; http_outbound_cache_revalidations; and http_outbound_cache_evictions, for the
+// responses removed to make room, which tells whether the cache is too small. The cached errors served with
+// CacheConfig.NegativeTTL are counted in http_outbound_cache_negative_hits.
+//
+// The responses served from the cache have the CacheHeader, set to CacheFresh, CacheStale or CacheRevalidated,
+// and an Age header. The calls answered without calling the API are not recorded in the metrics of the calls,
+// and have no span.
+//
+// Caching is off by default; enable it per API with WithHTTPCache. A Cache is safe for concurrent use by
+// multiple goroutines.
+type Cache struct {
+	cfg   CacheConfig
+	store cacheStore
+
+	// refreshing holds the keys of the entries revalidated in the background
+	mu         sync.Mutex
+	refreshing map[string]bool
+}
+
+// NewCache returns an empty Cache.
+func NewCache(c CacheConfig) *Cache {
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = 1000
+	}
+	if c.MaxBody <= 0 {
+		c.MaxBody = 1 << 20
+	}
+	if c.MaxDiskSize <= 0 {
+		c.MaxDiskSize = DefaultDiskCacheSize
+	}
+	if len(c.NegativeStatuses) == 0 {
+		c.NegativeStatuses = []int{http.StatusNotFound, http.StatusGone}
+	}
+	if c.Store != nil {
+		return &Cache{cfg: c, store: externalCacheStore{c.Store}, refreshing: map[string]bool{}}
+	}
+	if c.Dir != "" {
+		return &Cache{cfg: c, store: newDiskCacheStore(c.Dir, c.MaxDiskSize), refreshing: map[string]bool{}}
+	}
+	return &Cache{cfg: c, store: newMemoryCacheStore(c.MaxEntries), refreshing: map[string]bool{}}
+}
+
+// Cache returns the cache of the client, set with WithHTTPCache, WithConditionalRequests or WithCache, or nil.
+func (c *Client) Cache() *Cache {
+	return c.cfg.cache
+}
+
+// WithHTTPCache caches the responses of the calls in the cache. Set it per API, with New or a Registry.
+func WithHTTPCache(c *Cache) Option {
+	return func(cfg *config) {
+		cfg.cache = c
+	}
+}
+
+// WithConditionalRequests keeps the responses with an ETag or Last-Modified date, and sends conditional requests
+// for them with If-None-Match and If-Modified-Since, serving the kept body when the API responds 304 Not Modified.
+// It is a shorthand for WithHTTPCache with a Cache that revalidates every response; see CacheConfig.Revalidate.
+// Pass the option to New: the responses are kept across every client created with the same Option value.
+func WithConditionalRequests() Option {
+	return WithHTTPCache(NewCache(CacheConfig{Revalidate: true}))
+}
+
+// WithCache caches the successful responses to GET requests for the TTL in memory, whatever the cache headers
+// of the API, keeping up to 1000 responses of up to 1 MiB. For other limits, or to cache by some request headers,
+// use WithHTTPCache with a Cache with CacheConfig.TTL set. Pass the option to New: the responses are cached
+// across every client created with the same Option value.
+func WithCache(ttl time.Duration) Option {
+	return WithHTTPCache(NewCache(CacheConfig{TTL: ttl}))
+}
+
+// cacheEntry is a cached response
+type cacheEntry struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+
+	// Vary holds the values of the headers named by the Vary header in the request of the response
+	Vary http.Header `json:"vary,omitempty"`
+
+	// Negative tells that the response is an error cached for CacheConfig.NegativeTTL
+	Negative bool `json:"negative,omitempty"`
+
+	// Variants, if set, are the sorted names of the Vary header of the responses of the URL, which are stored
+	// under the keys of their variants; the entry itself is not a response
+	Variants []string `json:"variants,omitempty"`
+
+	// RequestTime and ResponseTime are when the request of the response was sent and when the response was received
+	RequestTime  time.Time `json:"requestTime"`
+	ResponseTime time.Time `json:"responseTime"`
+}
+
+// cacheStore stores the entries of a Cache by key.
+type cacheStore interface {
+	// get returns the entry stored under the key, or nil. The entry must not be modified.
+	get(ctx context.Context, key string) (*cacheEntry, error)
+	// set stores the entry under the key, for the ttl if it's not 0, and returns the number of entries evicted
+	// to make room. The memory and disk stores ignore the ttl, and keep the entries until they are evicted.
+	set(ctx context.Context, key string, e *cacheEntry, ttl time.Duration) (evicted int, err error)
+	delete(ctx context.Context, key string) error
+	// purge deletes the entries whose key matches.
+	purge(ctx context.Context, match func(key string) bool) error
+}
+
+// memoryCacheStore stores the entries in memory, dropping the least recently used entry when it is full
+type memoryCacheStore struct {
+	max int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// memoryCacheItem is an entry of a memoryCacheStore, kept in the LRU list
+type memoryCacheItem struct {
+	key   string
+	entry *cacheEntry
+}
+
+func newMemoryCacheStore(max int) *memoryCacheStore {
+	return &memoryCacheStore{max: max, entries: map[string]*list.Element{}, lru: list.New()}
+}
+
+func (s *memoryCacheStore) get(ctx context.Context, key string) (*cacheEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	s.lru.MoveToFront(el)
+	return el.Value.(*memoryCacheItem).entry, nil
+}
+
+func (s *memoryCacheStore) set(ctx context.Context, key string, e *cacheEntry, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		el.Value.(*memoryCacheItem).entry = e
+		s.lru.MoveToFront(el)
+		return 0, nil
+	}
+	evicted := 0
+	if s.lru.Len() >= s.max {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheItem).key)
+		evicted++
+	}
+	s.entries[key] = s.lru.PushFront(&memoryCacheItem{key: key, entry: e})
+	return evicted, nil
+}
+
+func (s *memoryCacheStore) delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.lru.Remove(el)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+func (s *memoryCacheStore) purge(ctx context.Context, match func(key string) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, el := range s.entries {
+		if match(key) {
+			s.lru.Remove(el)
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
+
+// Invalidate removes the cached responses whose URL matches the pattern, such as after a call that changed the
+// resources in a way the cache can't tell, like a POST to "https://api.example.com/orders" that changes
+// "https://api.example.com/customers/42/orders". In the pattern, '*' matches any sequence of characters,
+// including '/', and '?' matches any one character; a pattern without them matches the URL exactly:
+//
+//	client.Cache().Invalidate("https://api.example.com/customers/42/*")
+//
+// The responses cached for every value of CacheConfig.KeyHeaders and of the Vary headers of the URL are removed.
+// Invalidate on a nil Cache, the Cache of a Client without one, does nothing.
+func (c *Cache) Invalidate(pattern string) error {
+	if c == nil {
+		return nil
+	}
+	return c.store.purge(context.Background(), func(key string) bool {
+		return globMatch(pattern, keyURL(key))
+	})
+}
+
+// InvalidateAll removes every cached response. InvalidateAll on a nil Cache does nothing.
+func (c *Cache) InvalidateAll() error {
+	if c == nil {
+		return nil
+	}
+	return c.store.purge(context.Background(), func(string) bool { return true })
+}
+
+// keyURL returns the URL of the key.
+func keyURL(key string) string {
+	key, _, _ = strings.Cut(strings.TrimPrefix(key, http.MethodGet+" "), "\n")
+	return key
+}
+
+// globMatch reports whether s matches the pattern, in which '*' matches any sequence of characters
+// and '?' any one character.
+func globMatch(pattern, s string) bool {
+	// Backtrack to the last '*' on a mismatch, which is linear for the patterns of URLs
+	p, i := 0, 0
+	star, next := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, i
+			p++
+		case star >= 0:
+			next++
+			p, i = star+1, next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// key returns the key of the cached response of a GET request of the URL, with the hashed values of the
+// KeyHeaders of the request.
+func (c *Cache) key(req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(http.MethodGet + " " + req.URL.String())
+	for _, name := range c.cfg.KeyHeaders {
+		fmt.Fprintf(&b, "\n%s: %s", name, sha256Hex([]byte(strings.Join(req.Header.Values(name), ","))))
+	}
+	return b.String()
+}
+
+// variantKey returns the key of the variant of the response with the values of the headers, whose names
+// are sorted.
+func variantKey(key string, vary http.Header, names []string) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\nVary %s: %s", name, sha256Hex([]byte(strings.Join(vary.Values(name), ","))))
+	}
+	return b.String()
+}
+
+// lookup returns the cached response to the request, of the variant with its values of the Vary headers,
+// or nil.
+func (c *Cache) lookup(ctx context.Context, cfg *config, key string, req *http.Request) *cacheEntry {
+	entry, err := c.store.get(ctx, key)
+	if err == nil && entry != nil && len(entry.Variants) > 0 {
+		entry, err = c.store.get(ctx, variantKey(key, req.Header, entry.Variants))
+	}
+	if err != nil {
+		cfg.log().Warn("httpClient: reading the cache", "api", cfg.apiName, "error", err)
+		return nil
+	}
+	// A hash collision, or a response without Variants stored before
+	if entry != nil && !entry.matches(req) {
+		return nil
+	}
+	return entry
+}
+
+// save stores the response under the key, or, if it varies with some request headers, under the key of its
+// variant, with an entry listing the headers under the key. It returns the error recording the evictions.
+func (c *Cache) save(ctx context.Context, cfg *config, key string, e *cacheEntry) error {
+	if len(e.Vary) == 0 {
+		return c.set(ctx, cfg, key, e)
+	}
+	names := make([]string, 0, len(e.Vary))
+	for name := range e.Vary {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if err := c.set(ctx, cfg, key, &cacheEntry{Variants: names}); err != nil {
+		return err
+	}
+	return c.set(ctx, cfg, variantKey(key, e.Vary, names), e)
+}
+
+// do serves the request from the cache, or sends it with send and caches the response.
+func (c *Cache) do(req *http.Request, cfg *config, send func(*http.Request, *config) (*http.Response, error)) (*http.Response, error) {
+	ctx := req.Context()
+	key := c.key(req)
+	if req.Method != http.MethodGet {
+		response, err := send(req, cfg)
+		if httpErr, _ := splitError(err); httpErr == nil && unsafeMethod(req.Method) && response.StatusCode < 400 {
+			c.delete(ctx, cfg, key)
+		}
+		return response, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok {
+		return send(req, cfg)
+	}
+
+	entry := c.lookup(ctx, cfg, key, req)
+	now := time.Now()
+	if entry != nil && c.fresh(entry, reqCC, now) {
+		return entry.response(req, CacheFresh, now), recordHit(ctx, cfg, entry, CacheFresh)
+	}
+	if _, ok := reqCC["only-if-cached"]; ok {
+		return &http.Response{
+			Status:     "504 Gateway Timeout",
+			StatusCode: http.StatusGatewayTimeout,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	if entry != nil && c.servableStale(entry, reqCC, "stale-while-revalidate", c.cfg.StaleWhileRevalidate, now) {
+		c.refresh(key, req, entry, reqCC, cfg, send)
+		return entry.response(req, CacheStale, now), recordHit(ctx, cfg, entry, CacheStale)
+	}
+
+	response, err := c.fetch(key, req, entry, reqCC, cfg, send)
+	if entry != nil && upstreamError(req, response, err) &&
+		c.servableStale(entry, reqCC, "stale-if-error", c.cfg.StaleIfError, time.Now()) {
+		discard(response)
+		_, metricErr := splitError(err)
+		return entry.response(req, CacheStale, time.Now()), newError(cfg.apiName, nil, metricErr)
+	}
+	return response, err
+}
+
+// fetch sends the request, as a conditional request if there is an entry to revalidate, and caches the response.
+func (c *Cache) fetch(key string, req *http.Request, entry *cacheEntry, reqCC map[string]string, cfg *config, send func(*http.Request, *config) (*http.Response, error)) (*http.Response, error) {
+	ctx := req.Context()
+	out := req
+	if entry != nil && !conditional(req) {
+		out = entry.conditional(req)
+	}
+	requestTime := time.Now()
+	response, err := send(out, cfg)
+	if httpErr, _ := splitError(err); httpErr != nil {
+		return response, err
+	}
+	if !cfg.noMetrics {
+		if out != req {
+			err = withMetricError(cfg.apiName, err, recordRevalidation(ctx, cfg, response.StatusCode == http.StatusNotModified))
+		} else {
+			err = withMetricError(cfg.apiName, err, recordCache(ctx, cfg, cacheMisses))
+		}
+	}
+	if out != req && response.StatusCode == http.StatusNotModified {
+		discard(response)
+		updated := entry.revalidated(response, requestTime, time.Now())
+		err = withMetricError(cfg.apiName, err, c.save(ctx, cfg, key, updated))
+		return updated.response(req, CacheRevalidated, time.Now()), err
+	}
+	if response.StatusCode == http.StatusNotModified {
+		// The caller's own conditional request gets the 304 it asked for, which also revalidates the entry
+		// if it is about the same version
+		if entry != nil && entry.validatedBy(req, response) {
+			updated := entry.revalidated(response, requestTime, time.Now())
+			err = withMetricError(cfg.apiName, err, c.save(ctx, cfg, key, updated))
+		}
+		return response, err
+	}
+	response, metricErr := c.keep(ctx, cfg, key, req, reqCC, response, requestTime)
+	return response, withMetricError(cfg.apiName, err, metricErr)
+}
+
+// refresh revalidates the entry in the background, unless it is already being revalidated.
+func (c *Cache) refresh(key string, req *http.Request, entry *cacheEntry, reqCC map[string]string, cfg *config, send func(*http.Request, *config) (*http.Response, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing[key] {
+		return
+	}
+	c.refreshing[key] = true
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+		// The caller has its response, and may cancel the context once it is read
+		r := req.Clone(context.WithoutCancel(req.Context()))
+		response, err := c.fetch(key, r, entry, reqCC, cfg, send)
+		if httpErr, _ := splitError(err); httpErr != nil {
+			cfg.log().Warn("httpClient: revalidating a cached response", "api", cfg.apiName, "error", httpErr)
+			return
+		}
+		discard(response)
+	}()
+}
+
+// upstreamError reports whether the call failed because of the API or the network, rather than the caller.
+func upstreamError(req *http.Request, resp *http.Response, err error) bool {
+	if httpErr, _ := splitError(err); httpErr != nil {
+		return req.Context().Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// servableStale reports whether the stale entry can be served at the time under the stale-while-revalidate or
+// stale-if-error directive of RFC 5861, whose window defaults to def when the response doesn't have it.
+func (c *Cache) servableStale(e *cacheEntry, reqCC map[string]string, directive string, def time.Duration, now time.Time) bool {
+	cc := parseCacheControl(e.Header)
+	for _, d := range []string{"must-revalidate", "proxy-revalidate", "no-cache"} {
+		if _, ok := cc[d]; ok {
+			return false
+		}
+	}
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	window, ok := seconds(cc, directive)
+	if !ok {
+		window = def
+	}
+	lifetime := c.ttl(e)
+	if lifetime <= 0 {
+		lifetime = e.lifetime()
+	}
+	return window > 0 && e.age(now)-lifetime <= window
+}
+
+// keep stores the response if it can be cached, and returns it with its body restored, and the error recording
+// the evictions.
+func (c *Cache) keep(ctx context.Context, cfg *config, key string, req *http.Request, reqCC map[string]string, resp *http.Response, requestTime time.Time) (*http.Response, error) {
+	if !c.storable(reqCC, resp) {
+		// Only a new version of the resource replaces the cached response: an error of the API doesn't, so that
+		// the response may be served stale, nor does one about the caller, such as a 401 or a 429
+		if c.replaces(resp.StatusCode) {
+			c.delete(ctx, cfg, key)
+		}
+		return resp, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.cfg.MaxBody+1))
+	if err != nil || int64(len(body)) > c.cfg.MaxBody {
+		// Too large, or failed: return what was read followed by the rest, or the error
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), errReader{err}, resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	e := &cacheEntry{
+		Status:       resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		Negative:     c.negative(resp.StatusCode),
+		RequestTime:  requestTime,
+		ResponseTime: time.Now(),
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if e.Vary == nil {
+			e.Vary = http.Header{}
+		}
+		e.Vary[name] = req.Header.Values(name)
+	}
+	return resp, c.save(ctx, cfg, key, e)
+}
+
+// set stores the entry, logging the error if that fails, and returns the error recording the evictions.
+func (c *Cache) set(ctx context.Context, cfg *config, key string, e *cacheEntry) error {
+	evicted, err := c.store.set(ctx, key, e, c.retention(e))
+	if err != nil {
+		cfg.log().Warn("httpClient: writing the cache", "api", cfg.apiName, "error", err)
+	}
+	if cfg.noMetrics {
+		return nil
+	}
+	// The metric counts the measurements, one per evicted entry
+	for i := 0; i < evicted; i++ {
+		if err := recordCache(ctx, cfg, cacheEvictions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cache) delete(ctx context.Context, cfg *config, key string) {
+	if err := c.store.delete(ctx, key); err != nil {
+		cfg.log().Warn("httpClient: deleting from the cache", "api", cfg.apiName, "error", err)
+	}
+}
+
+// retention returns how long a CacheStore keeps the entry: as long as it can be served, fresh or stale, or,
+// if it can be revalidated, or lists the variants of a response, until the store evicts it.
+func (c *Cache) retention(e *cacheEntry) time.Duration {
+	if len(e.Variants) > 0 || e.validated() {
+		return 0
+	}
+	lifetime := c.ttl(e)
+	if lifetime <= 0 {
+		lifetime = e.lifetime()
+	}
+	cc := parseCacheControl(e.Header)
+	swr, ok := seconds(cc, "stale-while-revalidate")
+	if !ok {
+		swr = c.cfg.StaleWhileRevalidate
+	}
+	sie, ok := seconds(cc, "stale-if-error")
+	if !ok {
+		sie = c.cfg.StaleIfError
+	}
+	return max(time.Second, lifetime-e.age(time.Now())+max(swr, sie))
+}
+
+// recordHit records a response served from the cache, unless metrics are off.
+func recordHit(ctx context.Context, cfg *config, e *cacheEntry, served string) error {
+	if cfg.noMetrics {
+		return nil
+	}
+	m := cacheHits
+	if e.Negative {
+		m = cacheNegativeHits
+	}
+	return withMetricError(cfg.apiName, nil, recordCache(ctx, cfg, m, tag.Upsert(CacheTag, served)))
+}
+
+// recordRevalidation records the result of a conditional request.
+func recordRevalidation(ctx context.Context, cfg *config, notModified bool) error {
+	result := "modified"
+	if notModified {
+		result = "not_modified"
+	}
+	return recordCache(ctx, cfg, cacheRevalidations, tag.Upsert(RevalidationTag, result))
+}
+
+// recordCache counts one to the metric of the cache, tagged with the API and the extra tags.
+func recordCache(ctx context.Context, cfg *config, m *stats.Int64Measure, extra ...tag.Mutator) error {
+	mutators := append([]tag.Mutator{tag.Upsert(APINameTag, cfg.apiName), tag.Upsert(VersionTag, cfg.versionName)}, extra...)
+	return stats.RecordWithTags(ctx, mutators, m.M(1))
+}
+
+// unsafeMethod reports whether requests with the method change the resource, which invalidates its cached response.
+func unsafeMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// conditional reports whether the request is already a conditional request.
+func conditional(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+}
+
+// heuristicallyCacheable reports whether responses with the status can be cached without an explicit lifetime.
+func heuristicallyCacheable(status int) bool {
+	switch status {
+	case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+		return true
+	}
+	return false
+}
+
+// fresh reports whether the entry can be served at the time to a request with the Cache-Control directives.
+func (c *Cache) fresh(e *cacheEntry, reqCC map[string]string, now time.Time) bool {
+	switch {
+	case c.cfg.Revalidate && e.validated() && !e.Negative:
+		return false
+	case c.ttl(e) > 0:
+		_, noCache := reqCC["no-cache"]
+		return !noCache && now.Sub(e.ResponseTime) < c.ttl(e)
+	}
+	return e.fresh(reqCC, now)
+}
+
+// ttl returns the lifetime of the entry set by the CacheConfig, whatever its cache headers, or 0.
+func (c *Cache) ttl(e *cacheEntry) time.Duration {
+	if e.Negative {
+		return c.cfg.NegativeTTL
+	}
+	return c.cfg.TTL
+}
+
+// negative reports whether the responses with the status are cached for CacheConfig.NegativeTTL.
+func (c *Cache) negative(status int) bool {
+	return c.cfg.NegativeTTL > 0 && slices.Contains(c.cfg.NegativeStatuses, status)
+}
+
+// replaces reports whether a response with the status replaces the cached response, if it can't be stored itself.
+func (c *Cache) replaces(status int) bool {
+	switch {
+	case status >= 200 && status <= 299:
+		return status != http.StatusPartialContent
+	case status == http.StatusNotFound, status == http.StatusGone:
+		return true
+	}
+	return c.negative(status)
+}
+
+// storable reports whether the response to the request can be stored in a private cache.
+func (c *Cache) storable(reqCC map[string]string, resp *http.Response) bool {
+	cc := parseCacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if _, ok := reqCC["no-store"]; ok {
+		return false
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	if c.negative(resp.StatusCode) {
+		return true
+	}
+	if c.cfg.TTL > 0 {
+		return resp.StatusCode >= 200 && resp.StatusCode <= 299 && resp.StatusCode != http.StatusPartialContent
+	}
+	if _, ok := cc["max-age"]; ok {
+		return resp.StatusCode != http.StatusPartialContent
+	}
+	if resp.Header.Get("Expires") != "" {
+		return resp.StatusCode != http.StatusPartialContent
+	}
+	// Without an explicit lifetime, the response must have a heuristic lifetime or validators to be of use
+	return heuristicallyCacheable(resp.StatusCode) &&
+		(resp.Header.Get("Last-Modified") != "" || resp.Header.Get("ETag") != "")
+}
+
+// varyHeaders returns the canonical names of the headers of the Vary header.
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// parseCacheControl returns the directives of the Cache-Control header, by lower-case name, with their
+// unquoted values. A request without Cache-Control but with Pragma: no-cache gets no-cache.
+func parseCacheControl(h http.Header) map[string]string {
+	cc := map[string]string{}
+	values := h.Values("Cache-Control")
+	for _, v := range values {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	if len(values) == 0 && strings.EqualFold(h.Get("Pragma"), "no-cache") {
+		cc["no-cache"] = ""
+	}
+	return cc
+}
+
+// seconds returns the value of a directive in seconds, and whether it is set and valid.
+func seconds(cc map[string]string, name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// matches reports whether the request has the values of the headers the entry varies with.
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for name, values := range e.Vary {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// lifetime returns the freshness lifetime of the entry.
+func (e *cacheEntry) lifetime() time.Duration {
+	cc := parseCacheControl(e.Header)
+	if d, ok := seconds(cc, "max-age"); ok {
+		return d
+	}
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.ResponseTime
+	}
+	if v := e.Header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			// An invalid date is in the past
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && heuristicallyCacheable(e.Status) {
+		return min(date.Sub(lastModified)/10, 24*time.Hour)
+	}
+	return 0
+}
+
+// age returns the age of the entry at the time, following RFC 7234 section 4.2.3.
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	var apparent time.Duration
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		apparent = max(0, e.ResponseTime.Sub(date))
+	}
+	var ageValue time.Duration
+	if n, err := strconv.ParseInt(e.Header.Get("Age"), 10, 64); err == nil && n > 0 {
+		ageValue = time.Duration(n) * time.Second
+	}
+	corrected := ageValue + e.ResponseTime.Sub(e.RequestTime)
+	return max(apparent, corrected) + now.Sub(e.ResponseTime)
+}
+
+// fresh reports whether the entry can be served at the time to a request with the Cache-Control directives.
+func (e *cacheEntry) fresh(reqCC map[string]string, now time.Time) bool {
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	if _, ok := parseCacheControl(e.Header)["no-cache"]; ok {
+		return false
+	}
+	lifetime, age := e.lifetime(), e.age(now)
+	if maxAge, ok := seconds(reqCC, "max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := seconds(reqCC, "min-fresh"); ok {
+		age += minFresh
+	}
+	return lifetime > age
+}
+
+// validated reports whether the entry has an ETag or Last-Modified date to revalidate it with.
+func (e *cacheEntry) validated() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// validatedBy reports whether a 304 Not Modified response to the conditional request is about the version of the
+// entry: it has the validators of the entry, or, if it has none, the request had them.
+func (e *cacheEntry) validatedBy(req *http.Request, resp *http.Response) bool {
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		etag, lastModified = req.Header.Get("If-None-Match"), req.Header.Get("If-Modified-Since")
+	}
+	if etag != "" {
+		return etag == e.Header.Get("ETag")
+	}
+	return lastModified != "" && lastModified == e.Header.Get("Last-Modified")
+}
+
+// conditional returns a copy of the request that asks for the response only if it changed since the entry.
+func (e *cacheEntry) conditional(req *http.Request) *http.Request {
+	if !e.validated() {
+		return req
+	}
+	etag, lastModified := e.Header.Get("ETag"), e.Header.Get("Last-Modified")
+	r := req.Clone(req.Context())
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		r.Header.Set("If-Modified-Since", lastModified)
+	}
+	return r
+}
+
+// revalidated returns a copy of the entry updated with the headers of a 304 Not Modified response.
+func (e *cacheEntry) revalidated(resp *http.Response, requestTime time.Time, responseTime time.Time) *cacheEntry {
+	u := *e
+	u.Header = e.Header.Clone()
+	for name, values := range resp.Header {
+		if name != "Content-Length" && name != "Transfer-Encoding" {
+			u.Header[name] = values
+		}
+	}
+	u.RequestTime, u.ResponseTime = requestTime, responseTime
+	return &u
+}
+
+// response returns the entry as a response to the request, served as told by the CacheHeader value.
+func (e *cacheEntry) response(req *http.Request, served string, now time.Time) *http.Response {
+	h := e.Header.Clone()
+	h.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	h.Set(CacheHeader, served)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,59 @@
+package httpClient
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// CacheStore stores the responses of a Cache by key, encoded as bytes, such as in a store shared by the
+// instances of a service; see CacheConfig.Store and RedisCacheStore.
+//
+// A CacheStore must be safe for concurrent use by multiple goroutines.
+type CacheStore interface {
+	// Get returns the value stored under the key, or nil and no error if there is none.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores the value under the key for the ttl, or until the store evicts it if the ttl is 0.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete deletes the value stored under the key, if any.
+	Delete(ctx context.Context, key string) error
+
+	// DeleteMatching deletes the values whose key matches, for Cache.Invalidate.
+	DeleteMatching(ctx context.Context, match func(key string) bool) error
+}
+
+// externalCacheStore stores the entries in a CacheStore, encoded in JSON
+type externalCacheStore struct {
+	store CacheStore
+}
+
+func (s externalCacheStore) get(ctx context.Context, key string) (*cacheEntry, error) {
+	b, err := s.store.Get(ctx, key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		// Written by an incompatible version: a miss
+		return nil, nil
+	}
+	return &e, nil
+}
+
+func (s externalCacheStore) set(ctx context.Context, key string, e *cacheEntry, ttl time.Duration) (int, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	return 0, s.store.Set(ctx, key, b, ttl)
+}
+
+func (s externalCacheStore) delete(ctx context.Context, key string) error {
+	return s.store.Delete(ctx, key)
+}
+
+func (s externalCacheStore) purge(ctx context.Context, match func(key string) bool) error {
+	return s.store.DeleteMatching(ctx, match)
+}
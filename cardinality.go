@@ -0,0 +1,79 @@
+package httpClient
+
+import (
+	"log/slog"
+	"sync"
+
+	"go.opencensus.io/tag"
+)
+
+// OverflowTagValue is the tag value recorded in place of the values beyond the limit of WithCardinalityLimit.
+const OverflowTagValue = "__other__"
+
+// WithCardinalityLimit caps the number of distinct values of the tag recorded with the latency and counter metrics
+// of the calls. Values beyond the first max are recorded as OverflowTagValue, and a warning is logged the first time
+// that happens. This protects the monitoring bill from callers that put unbounded values in a tag, such as a raw
+// URL with IDs as the API name:
+//
+//	client := httpClient.New(httpClient.WithCardinalityLimit(httpClient.APINameTag, 100))
+//
+// Pass the option to New: the values are counted across every client created with the same Option value.
+func WithCardinalityLimit(key tag.Key, max int) Option {
+	g := &cardinalityGuard{key: key, max: max, seen: map[string]bool{}}
+	return func(cfg *config) {
+		cfg.guards = append(cfg.guards, g)
+	}
+}
+
+// cardinalityGuard counts the distinct values of a tag
+type cardinalityGuard struct {
+	key tag.Key
+	max int
+
+	mu     sync.Mutex
+	seen   map[string]bool
+	warned bool
+}
+
+// allow reports whether the value can be recorded, and whether the limit was just hit for the first time.
+func (g *cardinalityGuard) allow(value string) (ok bool, first bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.seen[value] {
+		return true, false
+	}
+	if len(g.seen) < g.max {
+		g.seen[value] = true
+		return true, false
+	}
+	first = !g.warned
+	g.warned = true
+	return false, first
+}
+
+// mutator returns the tag mutator that applies the limit to the tags it is applied after.
+func (g *cardinalityGuard) mutator(log *slog.Logger) tag.Mutator {
+	return guardMutator{guard: g, log: log}
+}
+
+// guardMutator replaces the value of the tag with OverflowTagValue when it is beyond the limit
+type guardMutator struct {
+	guard *cardinalityGuard
+	log   *slog.Logger
+}
+
+func (m guardMutator) Mutate(t *tag.Map) (*tag.Map, error) {
+	value, ok := t.Value(m.guard.key)
+	if !ok {
+		return t, nil
+	}
+	allowed, first := m.guard.allow(value)
+	if allowed {
+		return t, nil
+	}
+	if first {
+		m.log.Warn("httpClient: too many distinct tag values; recording the rest as "+OverflowTagValue,
+			"tag", m.guard.key.Name(), "limit", m.guard.max, "value", value)
+	}
+	return tag.Upsert(m.guard.key, OverflowTagValue).Mutate(t)
+}
@@ -0,0 +1,514 @@
+package httpClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/tag"
+)
+
+// Doer sends an HTTP request and returns the response. *http.Client implements Doer.
+// Supply a Doer with WithDoer to replace the HTTP call, for example with a stub in unit tests.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client calls HTTP services and records metrics via OpenCensus.
+// A Client is safe for concurrent use by multiple goroutines.
+type Client struct {
+	cfg config
+}
+
+// New returns a Client configured with the options.
+// The options become the defaults for every call made with the client.
+func New(opts ...Option) *Client {
+	return &Client{
+		cfg: defaultConfig().apply(opts),
+	}
+}
+
+// Do sends the request and returns the response.
+// The options override the client defaults for this call only.
+// Do sets a timeout on the call and propagates the trace context.
+// The latency and response are sent to OpenCensus metrics.
+// If a retry policy is set with WithRetry, failed calls are retried and each attempt is recorded.
+// If the HTTP call or recording the metrics fails, the returned error is an *Error;
+// use errors.Is(err, ErrHTTP) or errors.Is(err, ErrMetricRecord) to tell them apart.
+// The response can be non-nil even if err is non-nil, when only the metrics failed.
+func (c *Client) Do(req *http.Request, opts ...Option) (*http.Response, error) {
+	cfg := c.cfg.apply(opts)
+	if cfg.err != nil {
+		return nil, newError(cfg.apiName, cfg.err, nil)
+	}
+	if !cfg.versionSet {
+		// Detected only when needed, as it may ask the metadata server
+		cfg.versionName = DetectedVersion()
+	}
+	if len(cfg.endpoints) == 0 {
+		req = withBaseURL(req, cfg.baseURL)
+	}
+
+	req, restoreLabels := cfg.withProfilerLabels(req)
+	defer restoreLabels()
+
+	timeout, err := cfg.callTimeout(req.Context())
+	if err != nil {
+		return nil, newError(cfg.apiName, err, nil)
+	}
+	cfg.timeout = timeout
+
+	if len(cfg.header) > 0 {
+		req = req.Clone(req.Context())
+		for name, values := range cfg.header {
+			req.Header[name] = values
+		}
+	}
+
+	if req, err = cfg.withBaggage(req); err != nil {
+		return nil, newError(cfg.apiName, err, nil)
+	}
+
+	if req, err = cfg.withRequestID(req); err != nil {
+		return nil, newError(cfg.apiName, err, nil)
+	}
+
+	if cfg.idempotencyKey {
+		if req, err = withIdempotencyKey(req); err != nil {
+			return nil, newError(cfg.apiName, err, nil)
+		}
+	}
+
+	if req, err = cfg.bufferBody(req); err != nil {
+		return nil, newError(cfg.apiName, err, nil)
+	}
+
+	if cfg.cache != nil {
+		return cfg.cache.do(req, &cfg, c.send)
+	}
+	return c.send(req, &cfg)
+}
+
+// send makes the call once the request is ready, unless it is answered by the cache.
+func (c *Client) send(req *http.Request, cfg *config) (*http.Response, error) {
+	c.mirror(req, cfg)
+
+	var metricErr error
+	if !cfg.noMetrics {
+		var done func()
+		done, metricErr = trackInFlight(req.Context(), cfg.apiName)
+		defer done()
+	}
+
+	var (
+		response *http.Response
+		err      error
+	)
+	if key := dedupKey(req, cfg); cfg.dedup != nil && key != "" {
+		var shared bool
+		response, err, shared = cfg.dedup.do(req.Context(), key, func() (*http.Response, error) {
+			return c.do(req, cfg)
+		})
+		if shared {
+			// The metrics of the call belong to the caller that made it
+			err, _ = splitError(err)
+			if !cfg.noMetrics && metricErr == nil {
+				metricErr = recordDedupHit(req.Context(), cfg.apiName)
+			}
+		}
+	} else {
+		response, err = c.do(req, cfg)
+	}
+
+	httpErr, doMetricErr := splitError(err)
+	if metricErr == nil {
+		metricErr = doMetricErr
+	}
+	return response, newError(cfg.apiName, httpErr, metricErr)
+}
+
+// do makes the call once the request is ready, going through the load shedder and bulkhead.
+// The call is traced with a client span, which is the parent of the spans of the attempts.
+func (c *Client) do(req *http.Request, cfg *config) (response *http.Response, err error) {
+	req, span := cfg.startSpan(req)
+	attempts := 0
+	defer func() {
+		httpErr, _ := splitError(err)
+		span.end(cfg, response, httpErr, attempts)
+	}()
+
+	if cfg.shedder != nil {
+		if err := cfg.shedder.acquire(req.Context(), cfg.priority); err != nil {
+			var metricErr error
+			if errors.Is(err, ErrLoadShed) && !cfg.noMetrics {
+				metricErr = recordShed(req.Context(), cfg.apiName, cfg.priority)
+			}
+			return nil, newError(cfg.apiName, err, metricErr)
+		}
+		defer cfg.shedder.release()
+	}
+
+	var bulkheadErr error
+	if cfg.bulkheads != nil {
+		b := cfg.bulkheads.get(cfg.apiName)
+		if err := b.acquire(req.Context()); err != nil {
+			return nil, newError(cfg.apiName, err, nil)
+		}
+		if !cfg.noMetrics {
+			bulkheadErr = b.record(req.Context())
+		}
+		defer func() {
+			b.release()
+			if !cfg.noMetrics {
+				err = withMetricError(cfg.apiName, err, b.record(req.Context()))
+			}
+		}()
+	}
+
+	cl := newCall(cfg, req)
+	cl.metricError(bulkheadErr)
+	response, httpError := cl.retry(req)
+	attempts = cl.attempt
+	if cfg.errorReporter != nil {
+		cfg.errorReporter.observe(req, cfg, response, httpError)
+	}
+	if cfg.deadLetter != nil {
+		cfg.deadLetter.observe(req, cfg, response, httpError, cl.attempt)
+	}
+	if !cfg.noMetrics && cl.attempt > 0 {
+		cl.metricError(recordAttempts(req.Context(), cfg.apiName, cfg.versionName, cl.attempt))
+	}
+	return response, newError(cfg.apiName, httpError, cl.metricErr)
+}
+
+// call holds the state of one call to Client.Do, across retries and endpoints.
+type call struct {
+	cfg     *config
+	doer    Doer
+	breaker *breaker
+
+	// attempt is the number of the attempt being made, starting at 1
+	attempt int
+
+	// metricErr is the first error recording metrics
+	metricErr error
+
+	// reauthed is set once the call was retried with refreshed credentials after a 401; see WithCredentials
+	reauthed bool
+}
+
+// newCall returns the state for a call of the request with the configuration.
+func newCall(cfg *config, req *http.Request) *call {
+	cl := &call{cfg: cfg, doer: cfg.newDoer()}
+	if cfg.breakers != nil {
+		cl.breaker = cfg.breakers.get(breakerKey(cfg.apiName, req))
+	}
+	return cl
+}
+
+// metricError keeps err if it is the first error recording metrics.
+func (cl *call) metricError(err error) {
+	if err != nil && cl.metricErr == nil {
+		cl.metricErr = err
+	}
+}
+
+// retry makes the call, retrying it according to the retry policy.
+func (cl *call) retry(req *http.Request) (*http.Response, error) {
+	cfg := cl.cfg
+	if cfg.retry.Budget != nil {
+		cfg.retry.Budget.recordRequest()
+	}
+
+	for attempt := 1; ; attempt++ {
+		cl.attempt = attempt
+		attemptReq, span := cfg.startAttempt(req, attempt)
+		response, httpError := cl.failover(attemptReq)
+		delay, ok := cl.retryDelay(req, attempt, response, httpError)
+		if ok {
+			span.retrying(failureReason(response, httpError), delay)
+		}
+		span.endAttempt(cfg, response, httpError)
+		if !ok {
+			return response, httpError
+		}
+
+		next, err := rewind(req)
+		if err != nil {
+			// Fail clearly rather than retrying with an empty body
+			discard(response)
+			return nil, fmt.Errorf("%w (attempt %d failed: %v)", err, attempt, failureReason(response, httpError))
+		}
+		discard(response)
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+		req = next
+	}
+}
+
+// retryDelay returns the delay before the next attempt, and false if the attempt that returned
+// response and httpError should not be retried.
+func (cl *call) retryDelay(req *http.Request, attempt int, response *http.Response, httpError error) (time.Duration, bool) {
+	cfg := cl.cfg
+	if cl.reauth(req.Context(), response) {
+		return 0, true
+	}
+	if rejected(httpError) || !cfg.retry.shouldRetry(attempt, req, response, httpError) {
+		return 0, false
+	}
+	delay, ok := cfg.retry.delay(req.Context(), attempt, response)
+	if !ok {
+		return 0, false
+	}
+	if cfg.retry.Budget != nil && !cfg.retry.Budget.tryRetry() {
+		if !cfg.noMetrics {
+			cl.metricError(recordBudgetExhausted(req.Context(), cfg.apiName))
+		}
+		return 0, false
+	}
+	return delay, true
+}
+
+// failureReason describes why an attempt that returned response and httpError failed.
+func failureReason(response *http.Response, httpError error) string {
+	if httpError != nil {
+		return httpError.Error()
+	}
+	return response.Status
+}
+
+// rejected reports whether the error means the call was rejected by the client itself,
+// to protect the API, rather than failed. Rejected calls are not retried.
+func rejected(err error) bool {
+	return errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrConcurrencyLimit) || errors.Is(err, ErrDeadlineWouldExceed)
+}
+
+// failover sends the request to each endpoint in turn, until one of them doesn't fail.
+// Without endpoints, the request is sent to its own URL.
+func (cl *call) failover(req *http.Request) (*http.Response, error) {
+	endpoints := cl.cfg.endpoints
+	if len(endpoints) == 0 {
+		return cl.send(req, nil)
+	}
+	if cl.cfg.outliers != nil {
+		endpoints = cl.cfg.outliers.available(endpoints)
+	}
+	endpoints = order(endpoints)
+
+	for i := 0; ; i++ {
+		ep := endpoints[i]
+		response, httpError := cl.send(ep.apply(req), ep)
+		if i == len(endpoints)-1 || !cl.cfg.shouldFailover(req, response, httpError) {
+			return response, httpError
+		}
+		next, err := rewind(req)
+		if err != nil {
+			return response, httpError
+		}
+		discard(response)
+		req = next
+	}
+}
+
+// send makes the HTTP call once and records the metrics. ep is the endpoint the request is sent to, or nil.
+func (cl *call) send(req *http.Request, ep *endpoint) (*http.Response, error) {
+	cfg := cl.cfg
+	if err := cl.waitRateLimit(req.Context()); err != nil {
+		return nil, err
+	}
+	if err := cl.waitThrottle(req.Context()); err != nil {
+		return nil, err
+	}
+	// undo gives back what was taken for the request, if it ends up not being sent
+	var undo []func()
+	fail := func(err error) (*http.Response, error) {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		return nil, err
+	}
+
+	var limiter *adaptiveLimiter
+	if cfg.concurrency != nil {
+		limiter = cfg.concurrency.get(cfg.apiName)
+		if err := limiter.acquire(); err != nil {
+			return fail(err)
+		}
+		undo = append(undo, limiter.cancel)
+	}
+	if cl.breaker != nil {
+		if !cl.breaker.allow(req.Context()) {
+			return fail(ErrCircuitOpen)
+		}
+		undo = append(undo, cl.breaker.cancel)
+	}
+	if cfg.inFlight != nil {
+		if err := cfg.inFlight.acquire(req.Context()); err != nil {
+			return fail(err)
+		}
+		if !cfg.noMetrics {
+			cl.metricError(cfg.inFlight.record(req.Context()))
+		}
+		undo = append(undo, func() { cl.metricError(cfg.inFlight.release(!cfg.noMetrics)) })
+	}
+	if err := cl.checkDeadline(req.Context()); err != nil {
+		return fail(err)
+	}
+
+	if cfg.curl {
+		cl.logCurl(req)
+	}
+	req, requestBytes := countRequestBody(req)
+	var ph phases
+	req = ph.trace(req)
+
+	var har *harCapture
+	if cfg.har != nil {
+		har = cfg.har.capture(req, cfg.redaction())
+	}
+	var archived *harCapture
+	if cfg.archive != nil {
+		archived = cfg.archive.capture(req, cfg.apiName, cfg.redaction(), &ph)
+	}
+
+	start := time.Now()
+	var response *http.Response
+	var httpError error
+	if cfg.hedgeDelay > 0 && hedgeable(req) {
+		response, httpError = hedgedDo(cl.doer, req, cfg.hedgeDelay)
+	} else {
+		response, httpError = cl.doer.Do(req)
+	}
+	timeTaken := time.Since(start)
+	if response != nil {
+		ph.annotateServerTiming(parseServerTiming(response.Header))
+	}
+	if cfg.errorBody > 0 {
+		cl.keepErrorBody(response)
+	}
+
+	cl.trackLatency(timeTaken, httpError)
+	if cfg.inFlight != nil {
+		cfg.inFlight.releaseOnClose(response, !cfg.noMetrics)
+	}
+	if limiter != nil {
+		limiter.release(req.Context(), timeTaken, response, httpError)
+	}
+	if cl.breaker != nil {
+		cl.breaker.done(req.Context(), response, httpError)
+	}
+	cl.updateThrottle(req.Context(), response)
+	cl.recordOutlier(req.Context(), ep, httpError != nil || response.StatusCode >= 500)
+
+	if !cfg.noMetrics {
+		cl.record(req, ep, &ph, response, httpError, timeTaken, requestBytes())
+	}
+	har.finish(response, httpError, timeTaken, &ph)
+	archived.finish(response, httpError, timeTaken, &ph)
+	if cfg.requestLog != nil {
+		cl.logAttempt(req, ep, &ph, response, httpError, timeTaken, requestBytes())
+	}
+	if cfg.slowThreshold > 0 && timeTaken > cfg.slowThreshold {
+		cl.logSlow(req, ep, &ph, response, httpError, timeTaken)
+	}
+	return response, httpError
+}
+
+// record records the metrics of an attempt sent to ep (or nil) that returned response and httpError.
+func (cl *call) record(req *http.Request, ep *endpoint, ph *phases, response *http.Response, httpError error, timeTaken time.Duration, requestBytes int64) {
+	cfg := cl.cfg
+	tags := append(cfg.tags[:len(cfg.tags):len(cfg.tags)],
+		tag.Upsert(AttemptTag, strconv.Itoa(cl.attempt)),
+		tag.Upsert(OutcomeTag, cfg.outcome(response, httpError)),
+	)
+	if ep != nil {
+		tags = append(tags, tag.Upsert(EndpointTag, ep.name))
+	}
+	if reuse := ph.connReuse(); reuse != "" {
+		tags = append(tags, tag.Upsert(ConnReuseTag, reuse))
+	}
+	for _, g := range cfg.guards {
+		tags = append(tags, g.mutator(cfg.log()))
+	}
+	mutators := httpMetricTags(req.Method, cfg.apiName, cfg.versionName, response, httpError, tags)
+
+	if cfg.openCensus() {
+		extra := append(ph.measurements(), outboundHTTPRequestBytes.M(requestBytes))
+		attachments := ph.attachments()
+		cl.emit(req.Context(), func() error {
+			return recordHTTPMetrics(req.Context(), mutators, timeTaken, attachments, extra...)
+		})
+		recordResponseBytes(req.Context(), response, mutators, cl.metricError)
+		if cfg.serverTiming && response != nil {
+			cl.metricError(cl.recordServerTiming(req.Context(), mutators, parseServerTiming(response.Header)))
+		}
+	}
+	if cfg.openTelemetry() {
+		cl.metricError(cl.recordOTel(req, ep, response, httpError, timeTaken, requestBytes))
+	}
+	if cfg.statsd != nil {
+		cl.emit(req.Context(), func() error {
+			return cfg.statsd.record(req.Context(), mutators, timeTaken)
+		})
+	}
+}
+
+// callTimeout returns the timeout for a call made with the context.
+func (cfg *config) callTimeout(ctx context.Context) (time.Duration, error) {
+	if !cfg.deadlineTimeout {
+		return cfg.timeout, nil
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return cfg.timeout, nil
+	}
+	remaining := time.Until(deadline) - cfg.deadlineBuffer
+	if remaining <= 0 {
+		return 0, fmt.Errorf("httpClient: less than %v left until the context deadline: %w", cfg.deadlineBuffer, context.DeadlineExceeded)
+	}
+	return remaining, nil
+}
+
+// newDoer returns the Doer used to make the HTTP call: the Doer supplied with WithDoer,
+// or an *http.Client with the timeout and the OpenCensus or OpenTelemetry transport wrapped in the middleware.
+func (cfg *config) newDoer() Doer {
+	if cfg.doer != nil {
+		return cfg.doer
+	}
+	base := cfg.transport
+	if len(cfg.clientCerts) > 0 {
+		base = &certTransport{certs: cfg.clientCerts, base: base}
+	}
+	if cfg.credentials != nil {
+		base = &credentialTransport{provider: cfg.credentials, base: base}
+	}
+	switch {
+	case cfg.apiKey != nil && cfg.apiKey.Header != "":
+		base = &credentialTransport{provider: cfg.apiKey, base: base}
+	case cfg.apiKey != nil:
+		base = &apiKeyTransport{key: cfg.apiKey, base: base}
+	}
+	var rt http.RoundTripper = &spanCapture{base: base}
+	if cfg.openTelemetry() {
+		rt = cfg.otelTransport(rt)
+	}
+	if cfg.openCensus() {
+		oc := &ochttp.Transport{
+			Base:        rt,
+			Propagation: cfg.propagation,
+		}
+		if cfg.spanName != nil {
+			oc.FormatSpanName = func(req *http.Request) string { return cfg.spanName(req, cfg.apiName) }
+		}
+		rt = oc
+	}
+	return &http.Client{
+		Timeout:   cfg.timeout,
+		Transport: chain(rt, cfg.middleware),
+	}
+}
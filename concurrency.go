@@ -0,0 +1,156 @@
+package httpClient
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// ErrConcurrencyLimit is returned when an API already has as many calls in flight as
+// the adaptive concurrency limit allows.
+var ErrConcurrencyLimit = errors.New("httpClient: adaptive concurrency limit reached")
+
+var (
+	// OpenCensus metric definition for the adaptive concurrency limit
+	concurrencyLimit = stats.Int64("http_outbound_concurrency_limit", "Adaptive concurrency limit for the external HTTP API", stats.UnitDimensionless)
+)
+
+func init() {
+	registerGaugeMetric(concurrencyLimit, []tag.Key{APINameTag})
+}
+
+// AdaptiveConcurrencyConfig configures the adaptive concurrency limiter.
+// The limiter infers how many calls an API can handle at once from its latency and errors,
+// using additive increase / multiplicative decrease (AIMD): while calls succeed and the limit
+// is being used, the limit grows by one; when a call fails, or its latency exceeds
+// Tolerance times the baseline latency, the limit is multiplied by BackoffRatio.
+// The baseline is the lowest latency seen recently, so a gradual slowdown of the API
+// lowers the limit before it starts failing.
+type AdaptiveConcurrencyConfig struct {
+	// InitialLimit is the limit to start with. Defaults to 20.
+	InitialLimit int
+
+	// MinLimit and MaxLimit bound the limit. They default to 1 and 1000.
+	MinLimit int
+	MaxLimit int
+
+	// BackoffRatio is the factor the limit is multiplied by on a failure. Defaults to 0.9.
+	BackoffRatio float64
+
+	// Tolerance is how many times slower than the baseline a call may be before it
+	// counts as a sign of overload. Defaults to 2.
+	Tolerance float64
+
+	// IsFailure reports whether a call failed. By default a call failed if it returned an error, a 429 or a 5xx status.
+	IsFailure func(resp *http.Response, err error) bool
+}
+
+func (c AdaptiveConcurrencyConfig) withDefaults() AdaptiveConcurrencyConfig {
+	if c.InitialLimit <= 0 {
+		c.InitialLimit = 20
+	}
+	if c.MinLimit <= 0 {
+		c.MinLimit = 1
+	}
+	if c.MaxLimit <= 0 {
+		c.MaxLimit = 1000
+	}
+	if c.BackoffRatio <= 0 || c.BackoffRatio >= 1 {
+		c.BackoffRatio = 0.9
+	}
+	if c.Tolerance <= 1 {
+		c.Tolerance = 2
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		}
+	}
+	return c
+}
+
+// WithAdaptiveConcurrency limits the calls in flight to each API to a limit that adapts to
+// the observed latency and errors of the API. Calls over the limit fail immediately with
+// ErrConcurrencyLimit and are not retried. Every retry counts as a call.
+// Limiters are kept per API name. Pass the option to New: the limiters are shared by every
+// client created with the same Option value.
+// The current limit is recorded in the http_outbound_concurrency_limit metric.
+func WithAdaptiveConcurrency(c AdaptiveConcurrencyConfig) Option {
+	c = c.withDefaults()
+	limiters := newKeyed(func(key string) *adaptiveLimiter {
+		return &adaptiveLimiter{cfg: &c, apiName: key, limit: float64(c.InitialLimit)}
+	})
+	return func(cfg *config) {
+		cfg.concurrency = limiters
+	}
+}
+
+// adaptiveLimiter is the adaptive concurrency limiter for one API
+type adaptiveLimiter struct {
+	cfg     *AdaptiveConcurrencyConfig
+	apiName string
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	baseline time.Duration // lowest recent latency; 0 until the first success
+}
+
+// acquire takes a slot, or fails with ErrConcurrencyLimit if the limit is reached.
+func (l *adaptiveLimiter) acquire() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(l.limit) {
+		return ErrConcurrencyLimit
+	}
+	l.inFlight++
+	return nil
+}
+
+// cancel frees the slot taken by acquire, when the call was not made.
+func (l *adaptiveLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+}
+
+// release frees the slot taken by acquire and adjusts the limit from the outcome of the call.
+func (l *adaptiveLimiter) release(ctx context.Context, latency time.Duration, resp *http.Response, err error) {
+	l.mu.Lock()
+	inFlight := l.inFlight
+	l.inFlight--
+
+	old := int(l.limit)
+	overloaded := l.cfg.IsFailure(resp, err)
+	if !overloaded {
+		// Let the baseline drift up slowly, so it follows a permanent change in the API's latency
+		if l.baseline == 0 || latency < l.baseline {
+			l.baseline = latency
+		} else {
+			l.baseline += (latency - l.baseline) / 100
+		}
+		overloaded = float64(latency) > l.cfg.Tolerance*float64(l.baseline)
+	}
+
+	if overloaded {
+		l.limit = math.Max(float64(l.cfg.MinLimit), l.limit*l.cfg.BackoffRatio)
+	} else if inFlight*2 >= int(l.limit) {
+		// Only grow the limit when it is being used
+		l.limit = math.Min(float64(l.cfg.MaxLimit), l.limit+1)
+	}
+	limit := int(l.limit)
+	l.mu.Unlock()
+
+	if limit != old {
+		// The limiter keeps working if the gauge can't be recorded
+		_ = stats.RecordWithTags(ctx,
+			[]tag.Mutator{tag.Upsert(APINameTag, l.apiName)},
+			concurrencyLimit.M(int64(limit)))
+	}
+}
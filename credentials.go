@@ -0,0 +1,112 @@
+package httpClient
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definition for calls retried with refreshed credentials after a 401 response
+	outboundHTTPReauths = stats.Int64("http_outbound_reauths", "Calls to the external HTTP API retried with refreshed credentials after a 401 Unauthorized response", stats.UnitDimensionless)
+)
+
+func init() {
+	registerCounterMetric(outboundHTTPReauths, []tag.Key{APINameTag, VersionTag})
+}
+
+// CredentialProvider authenticates the calls to an API. The bearer tokens of WithTokenSource, BasicAuth,
+// the API keys of WithAPIKey and HMACSigner are CredentialProviders; implement it for other schemes.
+type CredentialProvider interface {
+	// Credentials returns the headers that authenticate the request, such as Authorization. The request must
+	// not be modified; its body, if needed, can be read with GetBody. Credentials is called for every attempt
+	// of a call, so it should cache credentials that are expensive to get.
+	Credentials(req *http.Request) (http.Header, error)
+}
+
+// CredentialRefresher is implemented by the CredentialProviders whose credentials can be refreshed or rotated,
+// such as when a token is revoked before it expires.
+type CredentialRefresher interface {
+	// Refresh is called when the API responds 401 Unauthorized to a request sent with the credentials.
+	// It discards the credentials, and reports whether the call should be retried with new ones.
+	Refresh(ctx context.Context, resp *http.Response) bool
+}
+
+// WithCredentials authenticates the calls with the provider. The credentials are added to the request right
+// before it is sent by the transport, so they don't appear in the logs, spans, HAR entries or archived calls.
+// If the credentials can't be found, the call fails with the error.
+//
+// If the provider is a CredentialRefresher and the API responds 401 Unauthorized, the credentials are refreshed
+// and the call is retried once, whatever the retry policy. The retry is counted in the http_outbound_reauths
+// metric; it is an attempt like any other in the other metrics. WithCredentials has no effect with WithDoer.
+func WithCredentials(p CredentialProvider) Option {
+	return func(cfg *config) {
+		cfg.credentials = p
+	}
+}
+
+// BasicAuth returns a CredentialProvider that authenticates the calls with HTTP basic authentication.
+func BasicAuth(username string, password string) CredentialProvider {
+	h := http.Header{}
+	h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	return staticCredentials(h)
+}
+
+// staticCredentials are headers sent with every request
+type staticCredentials http.Header
+
+func (c staticCredentials) Credentials(req *http.Request) (http.Header, error) {
+	return http.Header(c), nil
+}
+
+// credentialTransport adds the credentials of the provider to the requests
+type credentialTransport struct {
+	provider CredentialProvider
+	base     http.RoundTripper
+}
+
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h, err := t.provider.Credentials(req)
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	for name, values := range h {
+		r.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+// refreshable reports whether the calls may be retried with refreshed credentials.
+func (cfg *config) refreshable() bool {
+	_, ok := cfg.credentials.(CredentialRefresher)
+	return ok
+}
+
+// reauth reports whether the call should be retried with refreshed credentials because the API responded 401.
+// It is true at most once per call.
+func (cl *call) reauth(ctx context.Context, response *http.Response) bool {
+	cfg := cl.cfg
+	r, ok := cfg.credentials.(CredentialRefresher)
+	if !ok || cl.reauthed || response == nil || response.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	cl.reauthed = true
+	if !r.Refresh(ctx, response) {
+		return false
+	}
+	if !cfg.noMetrics {
+		cl.metricError(stats.RecordWithTags(ctx,
+			[]tag.Mutator{tag.Upsert(APINameTag, cfg.apiName), tag.Upsert(VersionTag, cfg.versionName)},
+			outboundHTTPReauths.M(1)))
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package httpClient
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxCurlBody is the largest request body included in the curl commands logged by WithCurlLogging
+const maxCurlBody = 64 << 10
+
+// WithCurlLogging logs every attempt of a call as an equivalent curl command at slog.LevelDebug, with the
+// logger set with WithLogger, to reproduce calls by hand. The headers, query parameters and body are redacted
+// with the Redactor set with WithRedactor, or as configured with WithRequestLogging, or with DefaultRedactor.
+// The body is included if it can be read again without consuming it, such as a bytes.Reader or a body
+// buffered for retries.
+func WithCurlLogging() Option {
+	return func(cfg *config) {
+		cfg.curl = true
+	}
+}
+
+// logCurl logs the request as a curl command.
+func (cl *call) logCurl(req *http.Request) {
+	ctx := context.WithoutCancel(req.Context())
+	log := cl.cfg.log()
+	if !log.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("api", cl.cfg.apiName),
+		slog.Int("attempt", cl.attempt),
+		slog.String("curl", curlCommand(req, cl.cfg.redaction())),
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	log.LogAttrs(ctx, slog.LevelDebug, "httpClient: curl", attrs...)
+}
+
+// curlCommand returns a curl command that sends the request, redacted with r.
+func curlCommand(req *http.Request, r *Redactor) string {
+	args := []string{"curl", "-X", shellQuote(req.Method)}
+
+	header := r.Headers(req.Header)
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range header[name] {
+			args = append(args, "-H", shellQuote(name+": "+v))
+		}
+	}
+
+	if hasBody(req) && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			b, err := io.ReadAll(io.LimitReader(body, maxCurlBody+1))
+			body.Close()
+			if err == nil && len(b) <= maxCurlBody {
+				args = append(args, "--data-binary", shellQuote(r.Body(req.Header.Get("Content-Type"), b)))
+			}
+		}
+	}
+
+	args = append(args, shellQuote(r.URL(req.URL)))
+	return strings.Join(args, " ")
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
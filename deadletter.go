@@ -0,0 +1,133 @@
+package httpClient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opencensus.io/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"golang.org/x/oauth2/google"
+)
+
+// DeadLetter is a call that failed after its retries, as published by a DeadLetterPublisher.
+type DeadLetter struct {
+	// APIName is the name of the API that was called.
+	APIName string `json:"apiName"`
+
+	// Method, URL and Header are those of the request, with the URL and headers redacted by the Redactor of
+	// the call; see WithRedactor.
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+
+	// Body is the body of the request, encoded in base64 in JSON. It is missing if the body couldn't be
+	// buffered; see RetryPolicy.MaxBufferedBody.
+	Body []byte `json:"body,omitempty"`
+
+	// Status is the status code of the last response, or 0 if the last attempt got no response.
+	Status int `json:"status,omitempty"`
+
+	// Error is the error of the last attempt, or "".
+	Error string `json:"error,omitempty"`
+
+	// Attempts is the number of attempts of the call.
+	Attempts int `json:"attempts"`
+
+	// RequestID and TraceID identify the call in the logs and traces.
+	RequestID string `json:"requestId,omitempty"`
+	TraceID   string `json:"traceId,omitempty"`
+
+	// Time is when the call failed.
+	Time time.Time `json:"time"`
+}
+
+// DeadLetterPublisher publishes the calls that failed after their retries to a Pub/Sub topic, as JSON DeadLetter
+// messages, so that another system can triage or replay them. The messages have the api, method and status
+// attributes, to filter the subscriptions. Calls canceled by the caller are not published.
+//
+// Create a DeadLetterPublisher with NewDeadLetterPublisher and pass it to WithDeadLetter.
+// A DeadLetterPublisher is safe for concurrent use by multiple goroutines.
+type DeadLetterPublisher struct {
+	client *Client
+	topic  string
+}
+
+// NewDeadLetterPublisher returns a DeadLetterPublisher that publishes to the topic, such as
+// "projects/my-project/topics/http-dead-letters", authenticated with the Application Default Credentials.
+// The messages are published with a Client created with the options, such as WithLogger.
+func NewDeadLetterPublisher(ctx context.Context, topic string, opts ...Option) (*DeadLetterPublisher, error) {
+	ts, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/pubsub")
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: finding credentials for Pub/Sub: %w", err)
+	}
+	opts = append([]Option{WithAPIName("pubsub.topics.publish"), WithTokenSource(ts)}, opts...)
+	return &DeadLetterPublisher{client: New(opts...), topic: topic}, nil
+}
+
+// WithDeadLetter publishes the calls that fail after their retries with the publisher. A call fails if its
+// outcome is a failure; see WithSuccessPredicate. The request body is buffered in memory to be published,
+// as it is for retries.
+func WithDeadLetter(p *DeadLetterPublisher) Option {
+	return func(cfg *config) {
+		cfg.deadLetter = p
+	}
+}
+
+// observe publishes the call in the background if it failed.
+func (p *DeadLetterPublisher) observe(req *http.Request, cfg *config, response *http.Response, err error, attempts int) {
+	ctx := req.Context()
+	if cfg.outcome(response, err) == "success" || ctx.Err() != nil {
+		return
+	}
+	r := cfg.redaction()
+	d := &DeadLetter{
+		APIName:   cfg.apiName,
+		Method:    req.Method,
+		URL:       r.URL(req.URL),
+		Header:    r.Headers(req.Header),
+		Attempts:  attempts,
+		RequestID: RequestIDFromContext(ctx),
+		Time:      time.Now(),
+	}
+	d.Body, _ = getBody(req)
+	if response != nil {
+		d.Status = response.StatusCode
+	}
+	if err != nil {
+		d.Error = r.errorString(req.URL, err)
+	}
+	if s := trace.FromContext(ctx); s != nil {
+		d.TraceID = s.SpanContext().TraceID.String()
+	} else if sc := oteltrace.SpanContextFromContext(ctx); sc.IsValid() {
+		d.TraceID = sc.TraceID().String()
+	}
+	go p.publish(d)
+}
+
+// publish publishes the dead letter, logging the error if that fails.
+func (p *DeadLetterPublisher) publish(d *DeadLetter) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		p.client.cfg.log().Warn("httpClient: encoding dead letter", "api", d.APIName, "error", err)
+		return
+	}
+	msg := map[string]any{
+		"data": base64.StdEncoding.EncodeToString(data),
+		"attributes": map[string]string{
+			"api":    d.APIName,
+			"method": d.Method,
+			"status": strconv.Itoa(d.Status),
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	u := "https://pubsub.googleapis.com/v1/" + p.topic + ":publish"
+	if _, err := PostJSON[struct{}](ctx, p.client, u, map[string]any{"messages": []any{msg}}); err != nil {
+		p.client.cfg.log().Warn("httpClient: publishing dead letter", "api", d.APIName, "url", d.URL, "error", err)
+	}
+}
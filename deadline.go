@@ -0,0 +1,99 @@
+package httpClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrDeadlineWouldExceed is returned when a call was not made because its context deadline
+// would pass before the API could be expected to respond.
+var ErrDeadlineWouldExceed = errors.New("httpClient: context deadline would be exceeded")
+
+// latencySamples is the number of recent latencies kept per API to estimate its p99 latency
+const latencySamples = 256
+
+// minLatencySamples is the number of latencies needed before the p99 estimate is used
+const minLatencySamples = 20
+
+// WithDeadlineShedding fails calls that can no longer meet their context deadline, instead of
+// sending a request that is doomed to time out. Just before each request is sent (after any time
+// spent waiting in the rate limiter, bulkhead, load shedding queue or retry backoff), the time left until
+// the deadline is compared with the 99th percentile latency of the API, estimated from its
+// recent successful calls. If less time is left, the call fails with ErrDeadlineWouldExceed.
+// Calls without a deadline are never shed.
+// Pass the option to New: latency estimates are shared by every client created with the same Option value.
+func WithDeadlineShedding() Option {
+	trackers := newKeyed(func(string) *latencyTracker {
+		return &latencyTracker{}
+	})
+	return func(cfg *config) {
+		cfg.latencies = trackers
+	}
+}
+
+// latencyTracker keeps the most recent latencies of an API
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples [latencySamples]time.Duration
+	n       int // number of samples added, ever
+}
+
+// add adds a latency sample.
+func (t *latencyTracker) add(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[t.n%latencySamples] = d
+	t.n++
+}
+
+// quantile returns the latency at quantile q (0 to 1) of the recent samples,
+// and false if there are not enough samples for a useful estimate.
+func (t *latencyTracker) quantile(q float64) (time.Duration, bool) {
+	t.mu.Lock()
+	n := t.n
+	if n > latencySamples {
+		n = latencySamples
+	}
+	if n < minLatencySamples {
+		t.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, t.samples[:n])
+	t.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(q*float64(n-1))], true
+}
+
+// checkDeadline returns ErrDeadlineWouldExceed if the time left until the context deadline
+// is less than the p99 latency of the API.
+func (cl *call) checkDeadline(ctx context.Context) error {
+	if cl.cfg.latencies == nil {
+		return nil
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	p99, ok := cl.cfg.latencies.get(cl.cfg.apiName).quantile(0.99)
+	if !ok {
+		return nil
+	}
+	if left := time.Until(deadline); left < p99 {
+		return fmt.Errorf("%w: %v left, p99 latency is %v", ErrDeadlineWouldExceed, left.Round(time.Millisecond), p99.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// trackLatency adds the latency of a successful call to the estimate of the API.
+func (cl *call) trackLatency(latency time.Duration, err error) {
+	if cl.cfg.latencies == nil || err != nil {
+		return
+	}
+	cl.cfg.latencies.get(cl.cfg.apiName).add(latency)
+}
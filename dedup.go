@@ -0,0 +1,129 @@
+package httpClient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definition for calls served by an identical call already in flight
+	dedupHits = stats.Int64("http_outbound_dedup_hits", "Calls to the external HTTP API served by an identical call already in flight", stats.UnitDimensionless)
+)
+
+func init() {
+	registerCounterMetric(dedupHits, []tag.Key{APINameTag})
+}
+
+// WithDeduplication coalesces identical GET requests that are in flight at the same time into one call:
+// the first caller makes the call, and the others wait for it and share its response.
+// Requests are identical if they have the same URL and headers, except for the request ID and idempotency key
+// headers, which differ on every call; see WithRequestID and WithIdempotencyKey. The response body is read
+// into memory, and every caller gets a response with its own copy of the body.
+// If the context of the caller making the call is cancelled, the waiting callers get the error too.
+// Pass the option to New: calls are coalesced across every client created with the same Option value.
+// Calls served by another call are counted in the http_outbound_dedup_hits metric.
+func WithDeduplication() Option {
+	g := &flightGroup{flights: map[string]*flight{}}
+	return func(cfg *config) {
+		cfg.dedup = g
+	}
+}
+
+// flightGroup holds the calls in flight, by key
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a call in flight; done is closed when the result is available
+type flight struct {
+	done chan struct{}
+	resp *http.Response // with the body read into body
+	body []byte
+	err  error
+}
+
+// do calls fn, unless a call with the same key is in flight, in which case it waits for that call.
+// shared is true if the result came from another call.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (*http.Response, error)) (resp *http.Response, err error, shared bool) {
+	g.mu.Lock()
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.response(), f.err, true
+		case <-ctx.Done():
+			return nil, ctx.Err(), true
+		}
+	}
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	f.resp, f.err = fn()
+	if f.resp != nil {
+		var readErr error
+		f.body, readErr = io.ReadAll(f.resp.Body)
+		f.resp.Body.Close()
+		if readErr != nil && f.err == nil {
+			f.resp, f.err = nil, fmt.Errorf("httpClient: reading response body: %w", readErr)
+		}
+	}
+
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+	close(f.done)
+
+	return f.response(), f.err, false
+}
+
+// response returns a copy of the response of the flight, with its own body.
+func (f *flight) response() *http.Response {
+	if f.resp == nil {
+		return nil
+	}
+	r := *f.resp
+	r.Header = f.resp.Header.Clone()
+	r.Body = io.NopCloser(bytes.NewReader(f.body))
+	r.ContentLength = int64(len(f.body))
+	return &r
+}
+
+// dedupKey returns the key identifying identical requests, or "" if the request can't be coalesced.
+// The headers set per call by the client are left out, so that they don't make every request unique.
+func dedupKey(req *http.Request, cfg *config) string {
+	if req.Method != http.MethodGet || hasBody(req) {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(req.URL.String())
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		if name == IdempotencyKeyHeader || (cfg.requestIDHeader != "" && name == http.CanonicalHeaderKey(cfg.requestIDHeader)) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n%s: %s", name, strings.Join(req.Header[name], ", "))
+	}
+	return b.String()
+}
+
+// recordDedupHit records that a call was served by an identical call already in flight.
+func recordDedupHit(ctx context.Context, apiName string) error {
+	return stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(APINameTag, apiName)},
+		dedupHits.M(1))
+}
@@ -0,0 +1,219 @@
+package httpClient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDiskCacheSize is the size of the files of a Cache stored on disk when CacheConfig.MaxDiskSize is not set.
+const DefaultDiskCacheSize = 100 << 20
+
+// diskCacheStore stores the entries in files in a directory, one per key, removing the least recently used
+// files when they take more than max bytes
+type diskCacheStore struct {
+	dir string
+	max int64
+
+	mu     sync.Mutex
+	loaded bool
+	size   int64
+}
+
+// diskCacheFile is the content of the file of an entry
+type diskCacheFile struct {
+	Key   string      `json:"key"`
+	Entry *cacheEntry `json:"entry"`
+}
+
+func newDiskCacheStore(dir string, max int64) *diskCacheStore {
+	return &diskCacheStore{dir: dir, max: max}
+}
+
+// path returns the path of the file of the key.
+func (s *diskCacheStore) path(key string) string {
+	return filepath.Join(s.dir, sha256Hex([]byte(key))+".json")
+}
+
+func (s *diskCacheStore) get(ctx context.Context, key string) (*cacheEntry, error) {
+	path := s.path(key)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f diskCacheFile
+	if err := json.Unmarshal(b, &f); err != nil || f.Key != key {
+		// A corrupt file, or another key with the same hash: a miss
+		return nil, nil
+	}
+	// The modification time orders the files for eviction
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return f.Entry, nil
+}
+
+// set writes the entry to a temporary file renamed to the file of the key, so that readers,
+// in this process or another, never see a partly written file.
+func (s *diskCacheStore) set(ctx context.Context, key string, e *cacheEntry, ttl time.Duration) (int, error) {
+	b, err := json.Marshal(diskCacheFile{Key: key, Entry: e})
+	if err != nil {
+		return 0, err
+	}
+	if err := s.load(); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	path := s.path(key)
+	var old int64
+	if info, statErr := os.Stat(path); statErr == nil {
+		old = info.Size()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return s.grow(int64(len(b)) - old), nil
+}
+
+func (s *diskCacheStore) delete(ctx context.Context, key string) error {
+	path := s.path(key)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	s.grow(-info.Size())
+	return nil
+}
+
+func (s *diskCacheStore) purge(ctx context.Context, match func(key string) bool) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	var removed int64
+	for _, f := range files {
+		b, err := os.ReadFile(f.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var file diskCacheFile
+		if err := json.Unmarshal(b, &file); err == nil && !match(file.Key) {
+			continue
+		}
+		// Corrupt files are removed too
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		removed += f.size
+	}
+	s.grow(-removed)
+	return nil
+}
+
+// load creates the directory and adds up the size of the files already in it, the first time it is called.
+func (s *diskCacheStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		s.size += f.size
+	}
+	s.loaded = true
+	return nil
+}
+
+// grow adds n bytes to the size of the files, and removes the least recently used files if they take too much,
+// returning the number of files removed.
+func (s *diskCacheStore) grow(n int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size += n
+	if s.size <= s.max {
+		return 0
+	}
+	files, err := s.files()
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	sort.Slice(files, func(i, j int) bool { return files[i].modified.Before(files[j].modified) })
+	// Make room for a tenth of the size, so that files aren't removed on every write
+	for _, f := range files {
+		if s.size <= s.max-s.max/10 {
+			break
+		}
+		if err := os.Remove(f.path); err == nil {
+			s.size -= f.size
+			removed++
+		}
+	}
+	return removed
+}
+
+// diskCacheInfo describes the file of an entry
+type diskCacheInfo struct {
+	path     string
+	size     int64
+	modified time.Time
+}
+
+// files returns the files of the entries in the directory.
+func (s *diskCacheStore) files() ([]diskCacheInfo, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []diskCacheInfo
+	for _, d := range dirEntries {
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, diskCacheInfo{path: filepath.Join(s.dir, d.Name()), size: info.Size(), modified: info.ModTime()})
+	}
+	return files, nil
+}
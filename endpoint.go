@@ -0,0 +1,141 @@
+package httpClient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.opencensus.io/tag"
+)
+
+var (
+	// EndpointTag is the host of the endpoint that served the request, when
+	// endpoints are configured with WithEndpoints.
+	EndpointTag = tag.MustNewKey("endpoint")
+)
+
+// endpoint is one of the base URLs an API is served from
+type endpoint struct {
+	url    *url.URL
+	name   string // used as the EndpointTag
+	weight int    // share of traffic, for weighted endpoints; 0 for ordered failover
+}
+
+// WeightedEndpoint is a base URL an API is served from, with its share of the traffic.
+type WeightedEndpoint struct {
+	URL    string
+	Weight int
+}
+
+// WithEndpoints sets the base URLs an API is served from: the primary, followed by fallbacks.
+// Requests are sent to the primary. If that fails with a connection error or a 5xx status,
+// the request is sent to the next endpoint, and so on; the response of the last endpoint is returned.
+// Like retries, failing over only happens for idempotent requests (see RetryPolicy.IsIdempotent).
+// The EndpointTag on the metrics records which endpoint served each request.
+//
+// A relative request URL is resolved against each endpoint, as with WithBaseURL, which
+// the endpoints take precedence over. An absolute request URL keeps its path, but gets the
+// scheme and host of each endpoint.
+// If a URL can't be parsed, Client.Do returns the error.
+func WithEndpoints(primary string, fallbacks ...string) Option {
+	var weighted []WeightedEndpoint
+	for _, u := range append([]string{primary}, fallbacks...) {
+		weighted = append(weighted, WeightedEndpoint{URL: u})
+	}
+	return withEndpoints(weighted)
+}
+
+// WithWeightedEndpoints spreads the traffic of an API across base URLs in proportion to their
+// weights, for example 90 and 10 while migrating to a new backend. Each request is sent to an
+// endpoint picked at random by weight; if it fails, the request fails over to the other endpoints,
+// also picked by weight, as described for WithEndpoints. Endpoints with a weight of 0 or less get no traffic
+// unless the others fail.
+// The EndpointTag on the metrics records which endpoint served each request, so they can be compared.
+func WithWeightedEndpoints(endpoints ...WeightedEndpoint) Option {
+	return withEndpoints(endpoints)
+}
+
+// withEndpoints parses the endpoints into an Option.
+func withEndpoints(weighted []WeightedEndpoint) Option {
+	var endpoints []*endpoint
+	var err error
+	for _, w := range weighted {
+		u, perr := url.Parse(w.URL)
+		if perr != nil {
+			err = fmt.Errorf("httpClient: invalid endpoint: %w", perr)
+			break
+		}
+		ep := &endpoint{url: u, name: u.Host, weight: w.Weight}
+		if ep.weight < 0 {
+			ep.weight = 0
+		}
+		endpoints = append(endpoints, ep)
+	}
+	return func(cfg *config) {
+		if err != nil {
+			cfg.err = err
+			return
+		}
+		cfg.endpoints = endpoints
+	}
+}
+
+// order returns the endpoints in the order to try them: as given, or, if any of them has a weight,
+// in a random order where each next endpoint is picked with a probability proportional to its weight.
+func order(endpoints []*endpoint) []*endpoint {
+	total := 0
+	for _, ep := range endpoints {
+		total += ep.weight
+	}
+	if total == 0 {
+		return endpoints
+	}
+
+	rest := append([]*endpoint(nil), endpoints...)
+	ordered := make([]*endpoint, 0, len(rest))
+	for total > 0 {
+		n := int(randFloat64() * float64(total))
+		for i, ep := range rest {
+			if n < ep.weight {
+				ordered = append(ordered, ep)
+				rest = append(rest[:i], rest[i+1:]...)
+				total -= ep.weight
+				break
+			}
+			n -= ep.weight
+		}
+	}
+	// Endpoints without weight are only used to fail over to
+	return append(ordered, rest...)
+}
+
+// apply returns a copy of the request, sent to the endpoint.
+func (ep *endpoint) apply(req *http.Request) *http.Request {
+	r := req.Clone(req.Context())
+	if req.URL.IsAbs() {
+		u := *req.URL
+		u.Scheme = ep.url.Scheme
+		u.Host = ep.url.Host
+		r.URL = &u
+	} else {
+		r.URL = resolveURL(ep.url, req.URL)
+	}
+	r.Host = ""
+	return r
+}
+
+// shouldFailover reports whether the request should be sent to the next endpoint
+// after the current one returned resp and err.
+func (cfg *config) shouldFailover(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	idempotent := isIdempotent
+	if cfg.retry.IsIdempotent != nil {
+		idempotent = cfg.retry.IsIdempotent
+	}
+	if !idempotent(req) {
+		return false
+	}
+	return err != nil || resp.StatusCode >= 500
+}
@@ -0,0 +1,66 @@
+package httpClient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// DefaultErrorBodySize is the size of the snippet of error responses kept by WithErrorBody when no size is given.
+const DefaultErrorBodySize = 2 << 10
+
+// errorBodyKey is the context key of the snippet of the body of an error response
+type errorBodyKey struct{}
+
+// WithErrorBody keeps the first max bytes (DefaultErrorBodySize if 0) of the body of responses with a status
+// outside 2xx, so that the upstream's error message is at hand without reproducing the call. The snippet is
+// the Body of the StatusError returned by the JSON helpers, and is logged by WithRequestLogging.
+// It is redacted like the logs; see WithRedactor. The whole body can still be read from the response.
+func WithErrorBody(max int) Option {
+	if max <= 0 {
+		max = DefaultErrorBodySize
+	}
+	return func(cfg *config) {
+		cfg.errorBody = max
+	}
+}
+
+// keepErrorBody keeps the snippet of the body of the response if its status is outside 2xx,
+// putting back what was read so the body can still be read in full.
+func (cl *call) keepErrorBody(resp *http.Response) {
+	if resp == nil || (resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+		return
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, int64(cl.cfg.errorBody)))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), errReader{err}, resp.Body), resp.Body}
+	if len(b) == 0 || resp.Request == nil {
+		return
+	}
+	snippet := cl.cfg.redaction().Body(resp.Header.Get("Content-Type"), b)
+	resp.Request = resp.Request.WithContext(context.WithValue(resp.Request.Context(), errorBodyKey{}, snippet))
+}
+
+// errorBody returns the snippet of the body of the response kept by WithErrorBody, or "".
+func errorBody(resp *http.Response) string {
+	if resp == nil || resp.Request == nil {
+		return ""
+	}
+	snippet, _ := resp.Request.Context().Value(errorBodyKey{}).(string)
+	return snippet
+}
+
+// errReader returns the error, if any, once the data read before it is consumed
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
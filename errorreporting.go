@@ -0,0 +1,168 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// ErrorReportingConfig configures an ErrorReporter.
+type ErrorReportingConfig struct {
+	// ProjectID is the project the errors are reported to.
+	ProjectID string
+
+	// Service and Version identify the program in Error Reporting. They default to the K_SERVICE environment
+	// variable of Cloud Run, or the name of the program, and to DetectedVersion.
+	Service string
+	Version string
+
+	// Threshold is the number of failed calls in a row to an API after which the failures are reported.
+	// Defaults to 3.
+	Threshold int
+
+	// Interval is the shortest time between two reports for an API, so that an outage doesn't flood
+	// Error Reporting. Defaults to one minute.
+	Interval time.Duration
+}
+
+// ErrorReporter reports the repeated failures of the calls to an API, a 5xx response or a transport error,
+// to Google Cloud Error Reporting, so that the failures of the dependencies show up next to the errors of the
+// program. Each report has the API name, the method and URL template of the call, and the stack of the caller.
+// Calls canceled by the caller are not failures.
+//
+// Create an ErrorReporter with NewErrorReporter and pass it to WithErrorReporting.
+// An ErrorReporter is safe for concurrent use by multiple goroutines.
+type ErrorReporter struct {
+	client *Client
+	cfg    ErrorReportingConfig
+
+	mu   sync.Mutex
+	apis map[string]*errorStreak
+}
+
+// errorStreak is the failures in a row of the calls to an API
+type errorStreak struct {
+	failures int
+	reported time.Time
+}
+
+// NewErrorReporter returns an ErrorReporter that reports to the project, authenticated with the Application
+// Default Credentials. The reports are sent with a Client created with the options, such as WithLogger.
+func NewErrorReporter(ctx context.Context, c ErrorReportingConfig, opts ...Option) (*ErrorReporter, error) {
+	ts, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: finding credentials for Error Reporting: %w", err)
+	}
+	if c.Service == "" {
+		c.Service = os.Getenv("K_SERVICE")
+	}
+	if c.Service == "" {
+		c.Service = filepath.Base(os.Args[0])
+	}
+	if c.Version == "" {
+		c.Version = DetectedVersion()
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = 3
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+	opts = append([]Option{WithAPIName("clouderrorreporting.events.report"), WithTokenSource(ts)}, opts...)
+	return &ErrorReporter{client: New(opts...), cfg: c, apis: map[string]*errorStreak{}}, nil
+}
+
+// WithErrorReporting reports the repeated failures of the calls with the reporter.
+func WithErrorReporting(r *ErrorReporter) Option {
+	return func(cfg *config) {
+		cfg.errorReporter = r
+	}
+}
+
+// observe counts the outcome of a call, and reports the failure in the background once the API has failed
+// Threshold times in a row.
+func (r *ErrorReporter) observe(req *http.Request, cfg *config, response *http.Response, err error) {
+	failed := (err != nil && req.Context().Err() == nil) || (err == nil && response.StatusCode >= 500)
+
+	r.mu.Lock()
+	s, ok := r.apis[cfg.apiName]
+	if !ok {
+		s = &errorStreak{}
+		r.apis[cfg.apiName] = s
+	}
+	if !failed {
+		s.failures = 0
+		r.mu.Unlock()
+		return
+	}
+	s.failures++
+	failures := s.failures
+	report := failures >= r.cfg.Threshold && time.Since(s.reported) >= r.cfg.Interval
+	if report {
+		s.reported = time.Now()
+	}
+	r.mu.Unlock()
+	if !report {
+		return
+	}
+
+	target := urlTemplate(req)
+	if target == "" {
+		target = req.URL.Path
+	}
+	redactor := cfg.redaction()
+	var msg string
+	status := 0
+	if err != nil {
+		msg = redactor.errorString(req.URL, err)
+	} else {
+		msg = response.Status
+		status = response.StatusCode
+	}
+	// Error Reporting groups the reports by the stack, which must follow the message
+	event := reportedErrorEvent{
+		EventTime: time.Now().UTC().Format(time.RFC3339Nano),
+		Message: fmt.Sprintf("httpClient: %s %s %s failed %d times in a row: %s\n\n%s",
+			cfg.apiName, req.Method, target, failures, msg, debug.Stack()),
+	}
+	event.ServiceContext.Service = r.cfg.Service
+	event.ServiceContext.Version = r.cfg.Version
+	event.Context.HTTPRequest.Method = req.Method
+	event.Context.HTTPRequest.URL = redactor.URL(req.URL)
+	event.Context.HTTPRequest.ResponseStatusCode = status
+	go r.report(event)
+}
+
+// reportedErrorEvent is the body of the events.report call of the Error Reporting API
+type reportedErrorEvent struct {
+	EventTime      string `json:"eventTime"`
+	ServiceContext struct {
+		Service string `json:"service"`
+		Version string `json:"version,omitempty"`
+	} `json:"serviceContext"`
+	Message string `json:"message"`
+	Context struct {
+		HTTPRequest struct {
+			Method             string `json:"method"`
+			URL                string `json:"url"`
+			ResponseStatusCode int    `json:"responseStatusCode,omitempty"`
+		} `json:"httpRequest"`
+	} `json:"context"`
+}
+
+// report sends the event, logging the error if that fails.
+func (r *ErrorReporter) report(event reportedErrorEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	u := "https://clouderrorreporting.googleapis.com/v1beta1/projects/" + r.cfg.ProjectID + "/events:report"
+	if _, err := PostJSON[struct{}](ctx, r.client, u, event); err != nil {
+		r.client.cfg.log().Warn("httpClient: reporting error to Error Reporting", "error", err)
+	}
+}
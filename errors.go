@@ -0,0 +1,126 @@
+package httpClient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrHTTP is matched by errors.Is when the HTTP call failed.
+	ErrHTTP = errors.New("httpClient: HTTP call failed")
+
+	// ErrMetricRecord is matched by errors.Is when the HTTP call was made, but the metrics
+	// could not be recorded.
+	ErrMetricRecord = errors.New("httpClient: recording metrics failed")
+)
+
+// Error is the error returned by Client.Do.
+// Either or both of HTTPErr and MetricErr are set.
+// Use errors.Is with ErrHTTP or ErrMetricRecord to tell the failures apart,
+// or errors.As to get at the Error itself.
+type Error struct {
+	// APIName is the name of the API that was called.
+	APIName string
+
+	// HTTPErr is the error returned by the HTTP call, or nil if the call succeeded.
+	HTTPErr error
+
+	// MetricErr is the error returned when recording metrics, or nil if the metrics were recorded.
+	MetricErr error
+}
+
+// newError returns an *Error if either of the errors is set, otherwise nil.
+func newError(apiName string, httpErr error, metricErr error) error {
+	if httpErr == nil && metricErr == nil {
+		return nil
+	}
+	return &Error{APIName: apiName, HTTPErr: httpErr, MetricErr: metricErr}
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.HTTPErr != nil && e.MetricErr != nil:
+		return fmt.Sprintf("httpClient: calling %q: %v (recording metrics also failed: %v)", e.APIName, e.HTTPErr, e.MetricErr)
+	case e.HTTPErr != nil:
+		return fmt.Sprintf("httpClient: calling %q: %v", e.APIName, e.HTTPErr)
+	default:
+		return fmt.Sprintf("httpClient: recording metrics for %q: %v", e.APIName, e.MetricErr)
+	}
+}
+
+// Is reports whether the error matches ErrHTTP or ErrMetricRecord.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrHTTP:
+		return e.HTTPErr != nil
+	case ErrMetricRecord:
+		return e.MetricErr != nil
+	}
+	return false
+}
+
+// Unwrap returns the HTTP error if there is one, otherwise the metric error.
+func (e *Error) Unwrap() error {
+	if e.HTTPErr != nil {
+		return e.HTTPErr
+	}
+	return e.MetricErr
+}
+
+// withMetricError returns err with the metric error, unless err already holds one.
+func withMetricError(apiName string, err error, metricErr error) error {
+	httpErr, first := splitError(err)
+	if first == nil {
+		first = metricErr
+	}
+	return newError(apiName, httpErr, first)
+}
+
+// splitError is the inverse of newError; it returns the HTTP and metric errors held by err.
+// Errors that are not an *Error are treated as HTTP errors.
+func splitError(err error) (httpErr error, metricErr error) {
+	if err == nil {
+		return nil, nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.HTTPErr, e.MetricErr
+	}
+	return err, nil
+}
+
+// StatusError is returned by the JSON helpers when the response has a status code outside 2xx.
+// The errors of Google APIs are returned as a *GoogleAPIError, which wraps the StatusError.
+type StatusError struct {
+	// StatusCode is the HTTP status code of the response, such as 404.
+	StatusCode int
+
+	// Status is the HTTP status of the response, such as "404 Not Found".
+	Status string
+
+	// Method and URL identify the request.
+	Method string
+	URL    string
+
+	// Body is the start of the body of the response, if kept with WithErrorBody.
+	Body string
+}
+
+// newStatusError returns a *StatusError describing the response.
+func newStatusError(resp *http.Response) *StatusError {
+	e := &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.URL = resp.Request.URL.Redacted()
+	}
+	e.Body = errorBody(resp)
+	return e
+}
+
+func (e *StatusError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("httpClient: %s %s: unexpected status %s: %s", e.Method, e.URL, e.Status, e.Body)
+	}
+	return fmt.Sprintf("httpClient: %s %s: unexpected status %s", e.Method, e.URL, e.Status)
+}
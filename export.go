@@ -0,0 +1,95 @@
+package httpClient
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/stackdriver"
+	"go.opencensus.io/metric/metricexport"
+)
+
+// DefaultReportingInterval is how often StartExporting exports the metrics, unless set with ReportingInterval.
+// Cloud Monitoring accepts a point for a time series at most every 5 seconds; the exporter requires at least 10.
+const DefaultReportingInterval = time.Minute
+
+// ExportOption configures the exporter of StartExporting. Any stackdriver.Options field can be set with
+// an ExportOption.
+type ExportOption func(*stackdriver.Options)
+
+// ReportingInterval sets how often the metrics are exported. Defaults to DefaultReportingInterval.
+func ReportingInterval(d time.Duration) ExportOption {
+	return func(o *stackdriver.Options) {
+		o.ReportingInterval = d
+	}
+}
+
+// MetricPrefix sets the prefix of the metric types in Cloud Monitoring.
+// Defaults to custom.googleapis.com/opencensus/.
+func MetricPrefix(prefix string) ExportOption {
+	return func(o *stackdriver.Options) {
+		o.MetricPrefix = prefix
+	}
+}
+
+var exporting struct {
+	mu       sync.Mutex
+	exporter *stackdriver.Exporter
+}
+
+// StartExporting exports the metrics of this package, and any other OpenCensus metrics, to Cloud Monitoring
+// in the project, against the monitored resource of DetectMonitoredResource. Call StopExporting when the
+// program exits, such as when Cloud Run sends SIGTERM, to export the metrics recorded since the last report:
+//
+//	if err := httpClient.StartExporting("my-project"); err != nil {
+//		...
+//	}
+//	defer httpClient.StopExporting()
+//
+// Errors exporting the metrics are logged with slog.Default(). StartExporting fails if the metrics are
+// already exported.
+func StartExporting(projectID string, opts ...ExportOption) error {
+	exporting.mu.Lock()
+	defer exporting.mu.Unlock()
+	if exporting.exporter != nil {
+		return errors.New("httpClient: the metrics are already exported; call StopExporting first")
+	}
+
+	o := stackdriver.Options{
+		ProjectID:         projectID,
+		ReportingInterval: DefaultReportingInterval,
+		OnError: func(err error) {
+			slog.Default().Error("httpClient: exporting metrics to Cloud Monitoring", "error", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	e, err := NewStackdriverExporter(o)
+	if err != nil {
+		return fmt.Errorf("httpClient: creating Cloud Monitoring exporter: %w", err)
+	}
+	if err := e.StartMetricsExporter(); err != nil {
+		return fmt.Errorf("httpClient: starting Cloud Monitoring exporter: %w", err)
+	}
+	exporting.exporter = e
+	return nil
+}
+
+// StopExporting stops the export started by StartExporting, after exporting the metrics recorded since
+// the last report. It returns once they are sent. It does nothing if the metrics are not exported.
+func StopExporting() {
+	exporting.mu.Lock()
+	defer exporting.mu.Unlock()
+	e := exporting.exporter
+	if e == nil {
+		return
+	}
+	e.StopMetricsExporter()
+	// Stopping the exporter doesn't export the last interval
+	metricexport.NewReader().ReadAndExport(e)
+	e.Flush()
+	exporting.exporter = nil
+}
@@ -0,0 +1,148 @@
+package httpClient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// QuotaProjectHeader is the header that attributes the quota and billing of a call to a Google API to a project.
+const QuotaProjectHeader = "X-Goog-User-Project"
+
+// WithQuotaProject attributes the quota and billing of the calls to Google APIs to the project, rather than
+// to the project of the credentials, by setting the X-Goog-User-Project header. The caller needs the
+// serviceusage.services.use permission on the project. Set it per API, with New or a Registry:
+//
+//	registry.Register("bigquery.jobs.query", httpClient.WithQuotaProject("analytics-billing"))
+func WithQuotaProject(project string) Option {
+	return WithHeader(QuotaProjectHeader, project)
+}
+
+// maxGoogleAPIErrorBody is the size of the error responses parsed into a GoogleAPIError
+const maxGoogleAPIErrorBody = 64 << 10
+
+// ErrorInfoType is the type of the ErrorInfo detail of the errors of Google APIs.
+const ErrorInfoType = "type.googleapis.com/google.rpc.ErrorInfo"
+
+// GoogleAPIError is the error of a Google API, returned by the JSON helpers when a response with a status
+// code outside 2xx has the {"error": {...}} payload of Google APIs. It wraps the *StatusError of the response,
+// so errors.As finds either:
+//
+//	var gerr *httpClient.GoogleAPIError
+//	if errors.As(err, &gerr) && gerr.Reason() == "RATE_LIMIT_EXCEEDED" {
+//		...
+//	}
+type GoogleAPIError struct {
+	// Code is the HTTP status code of the error, such as 403.
+	Code int
+
+	// Status is the canonical error code, such as "PERMISSION_DENIED".
+	Status string
+
+	// Message is the description of the error for developers.
+	Message string
+
+	// ErrorInfo is the ErrorInfo detail of the error, if any. For the APIs that return the older errors list,
+	// such as Cloud Storage, it holds the reason and domain of the first error of the list.
+	ErrorInfo *ErrorInfo
+
+	// Details are the details of the error, such as google.rpc.ErrorInfo, google.rpc.RetryInfo or
+	// google.rpc.BadRequest, each a JSON object with an "@type" field.
+	Details []json.RawMessage
+
+	// StatusError is the error of the response.
+	StatusError *StatusError
+}
+
+// ErrorInfo is the reason of an error of a Google API; see https://google.aip.dev/193.
+type ErrorInfo struct {
+	// Reason is the reason of the error, such as "API_KEY_INVALID" or "rateLimitExceeded".
+	Reason string `json:"reason"`
+
+	// Domain is the service that generated the error, such as "googleapis.com".
+	Domain string `json:"domain"`
+
+	// Metadata holds the details of the error, such as the name of the exhausted quota.
+	Metadata map[string]string `json:"metadata"`
+}
+
+func (e *GoogleAPIError) Error() string {
+	s := e.StatusError
+	msg := fmt.Sprintf("httpClient: %s %s: %s", s.Method, s.URL, s.Status)
+	if e.Status != "" {
+		msg += " " + e.Status
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if r := e.Reason(); r != "" {
+		msg += " (reason " + r + ")"
+	}
+	return msg
+}
+
+// Unwrap returns the StatusError of the response.
+func (e *GoogleAPIError) Unwrap() error {
+	return e.StatusError
+}
+
+// Reason returns the reason of the ErrorInfo of the error, or "".
+func (e *GoogleAPIError) Reason() string {
+	if e.ErrorInfo == nil {
+		return ""
+	}
+	return e.ErrorInfo.Reason
+}
+
+// responseError returns the error of a response with a status code outside 2xx: a *GoogleAPIError if the body
+// is the error of a Google API, otherwise a *StatusError.
+func responseError(resp *http.Response) error {
+	se := newStatusError(resp)
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return se
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxGoogleAPIErrorBody))
+	if err != nil {
+		return se
+	}
+	e, ok := parseGoogleAPIError(b)
+	if !ok {
+		return se
+	}
+	e.StatusError = se
+	return e
+}
+
+// parseGoogleAPIError parses the body of an error response of a Google API, and reports whether it is one.
+func parseGoogleAPIError(b []byte) (*GoogleAPIError, bool) {
+	var payload struct {
+		Error *struct {
+			Code    int               `json:"code"`
+			Status  string            `json:"status"`
+			Message string            `json:"message"`
+			Details []json.RawMessage `json:"details"`
+			Errors  []ErrorInfo       `json:"errors"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(b, &payload); err != nil || payload.Error == nil || payload.Error.Code == 0 {
+		return nil, false
+	}
+	p := payload.Error
+	e := &GoogleAPIError{Code: p.Code, Status: p.Status, Message: p.Message, Details: p.Details}
+	for _, d := range p.Details {
+		var info struct {
+			Type string `json:"@type"`
+			ErrorInfo
+		}
+		if json.Unmarshal(d, &info) == nil && info.Type == ErrorInfoType {
+			e.ErrorInfo = &info.ErrorInfo
+			break
+		}
+	}
+	if e.ErrorInfo == nil && len(p.Errors) > 0 && p.Errors[0].Reason != "" {
+		e.ErrorInfo = &ErrorInfo{Reason: p.Errors[0].Reason, Domain: p.Errors[0].Domain}
+	}
+	return e, true
+}
@@ -0,0 +1,343 @@
+package httpClient
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultHARMaxBody is the number of bytes of the bodies kept by a HARRecorder when no limit is given.
+const DefaultHARMaxBody = 64 << 10
+
+// DefaultHAREntries is the number of entries kept by a HARRecorder when no limit is given.
+const DefaultHAREntries = 1000
+
+// HARRecorder captures a sample of the calls, with their headers and truncated bodies, in the HTTP Archive (HAR)
+// format, which can be opened in the network panel of browser developer tools or used as test fixtures.
+// The most recent entries are kept in memory, up to maxEntries; write them out with WriteFile or WriteTo.
+// The entries are redacted with the Redactor of the call; see WithRedactor.
+//
+// Create a HARRecorder with NewHARRecorder and pass it to WithHAR.
+// A HARRecorder is safe for concurrent use by multiple goroutines.
+type HARRecorder struct {
+	sampleRate float64
+	maxBody    int
+	maxEntries int
+
+	mu      sync.Mutex
+	entries []*harEntry
+}
+
+// NewHARRecorder returns a HARRecorder that captures the fraction sampleRate of the calls, between 0 and 1,
+// keeping up to maxBody bytes of each body (DefaultHARMaxBody if 0) and up to maxEntries entries
+// (DefaultHAREntries if 0).
+func NewHARRecorder(sampleRate float64, maxBody int, maxEntries int) *HARRecorder {
+	if maxBody <= 0 {
+		maxBody = DefaultHARMaxBody
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultHAREntries
+	}
+	return &HARRecorder{sampleRate: sampleRate, maxBody: maxBody, maxEntries: maxEntries}
+}
+
+// WithHAR captures a sample of the attempts of the calls with the recorder.
+func WithHAR(r *HARRecorder) Option {
+	return func(cfg *config) {
+		cfg.har = r
+	}
+}
+
+// WriteTo writes the captured entries to w as a HAR document.
+func (r *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	doc := harDocument{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "httpClient", Version: "1"},
+		Entries: append([]*harEntry(nil), r.entries...),
+	}}
+	r.mu.Unlock()
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// WriteFile writes the captured entries to the file as a HAR document.
+func (r *HARRecorder) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := r.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Reset discards the captured entries.
+func (r *HARRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = nil
+}
+
+// add keeps the entry, discarding the oldest one if the recorder is full.
+func (r *HARRecorder) add(e *harEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) >= r.maxEntries {
+		r.entries = append(r.entries[:0], r.entries[1:]...)
+	}
+	r.entries = append(r.entries, e)
+}
+
+// capture starts the entry of a request, redacted with rd, or returns nil if the request is not sampled.
+func (r *HARRecorder) capture(req *http.Request, rd *Redactor) *harCapture {
+	if randFloat64() >= r.sampleRate {
+		return nil
+	}
+	return newHARCapture(req, r.maxBody, rd, r.add)
+}
+
+// newHARCapture starts the entry of a request, redacted with r; done is called with the entry once the
+// response body is read.
+func newHARCapture(req *http.Request, maxBody int, r *Redactor, done func(*harEntry)) *harCapture {
+	return &harCapture{
+		entry:    newHAREntry(req, r, maxBody),
+		url:      req.URL,
+		maxBody:  maxBody,
+		redactor: r,
+		done:     done,
+	}
+}
+
+// harCapture is an entry being captured; done is called with the entry once the response body is read
+type harCapture struct {
+	entry    *harEntry
+	url      *url.URL
+	maxBody  int
+	redactor *Redactor
+	done     func(*harEntry)
+}
+
+// finish completes the entry with the response, once the response body is closed or fully read.
+func (c *harCapture) finish(resp *http.Response, err error, latency time.Duration, ph *phases) {
+	if c == nil {
+		return
+	}
+	c.entry.setTimings(latency, ph)
+	if resp == nil {
+		c.entry.Response = harResponse{HTTPVersion: "", Headers: []harNameValue{}, Cookies: []harNameValue{}, BodySize: -1, HeadersSize: -1}
+		if err != nil {
+			c.entry.Comment = c.redactor.errorString(c.url, err)
+		}
+		c.done(c.entry)
+		return
+	}
+	c.entry.setResponse(resp, c.redactor)
+	resp.Body = &captureBody{ReadCloser: resp.Body, max: c.maxBody, done: func(body []byte, size int64) {
+		c.entry.Response.Content.Text = c.redactor.Body(c.entry.Response.Content.MimeType, body)
+		c.entry.Response.Content.Size = size
+		c.entry.Response.BodySize = size
+		c.done(c.entry)
+	}}
+}
+
+// captureBody is a response body that keeps the first max bytes read, and calls done when it is fully read or closed
+type captureBody struct {
+	io.ReadCloser
+	max  int
+	buf  []byte
+	n    int64
+	once sync.Once
+	done func(body []byte, size int64)
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if room := b.max - len(b.buf); room > 0 {
+		b.buf = append(b.buf, p[:min(n, room)]...)
+	}
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.buf, b.n) })
+	}
+	return n, err
+}
+
+func (b *captureBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.buf, b.n) })
+	return err
+}
+
+// The HAR 1.2 format; see http://www.softwareishard.com/blog/har-12-spec/
+
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+// harTimings are in milliseconds; -1 means the phase doesn't apply or is unknown
+type harTimings struct {
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// newHAREntry returns an entry with the request, redacted with r, and up to maxBody bytes of the body.
+func newHAREntry(req *http.Request, r *Redactor, maxBody int) *harEntry {
+	e := &harEntry{
+		StartedDateTime: time.Now(),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         r.URL(req.URL),
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(r.Headers(req.Header)),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    req.ContentLength,
+		},
+	}
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			if slices.Contains(r.Query, name) {
+				v = RedactedValue
+			}
+			e.Request.QueryString = append(e.Request.QueryString, harNameValue{Name: name, Value: r.scrub(v)})
+		}
+	}
+	if hasBody(req) && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(io.LimitReader(body, int64(maxBody)))
+			body.Close()
+			ct := req.Header.Get("Content-Type")
+			e.Request.PostData = &harPostData{MimeType: ct, Text: r.Body(ct, b)}
+		}
+	}
+	return e
+}
+
+// setResponse sets the response of the entry, redacted with r. The body is set when it is read.
+func (e *harEntry) setResponse(resp *http.Response, r *Redactor) {
+	e.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(r.Headers(resp.Header)),
+		Content:     harContent{Size: -1, MimeType: resp.Header.Get("Content-Type")},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+}
+
+// setTimings sets the timings of the entry from the phases of the request.
+func (e *harEntry) setTimings(latency time.Duration, ph *phases) {
+	ms := func(start time.Time, end time.Time) float64 {
+		if start.IsZero() || end.IsZero() {
+			return -1
+		}
+		return float64(end.Sub(start).Microseconds()) / 1000
+	}
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	e.Time = float64(latency.Microseconds()) / 1000
+	e.Timings = harTimings{
+		DNS:     ms(ph.dnsStart, ph.dnsDone),
+		Connect: ms(ph.connectStart, ph.connectDone),
+		SSL:     ms(ph.tlsStart, ph.tlsDone),
+		Send:    0,
+		Wait:    ms(ph.wroteRequest, ph.firstByte),
+		Receive: 0,
+	}
+	if e.Timings.Wait < 0 {
+		e.Timings.Wait = e.Time
+	}
+}
+
+// harHeaders returns the headers as HAR name-value pairs.
+func harHeaders(h http.Header) []harNameValue {
+	nv := []harNameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			nv = append(nv, harNameValue{Name: name, Value: v})
+		}
+	}
+	return nv
+}
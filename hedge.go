@@ -0,0 +1,99 @@
+package httpClient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WithHedging turns on hedged requests: if no response has arrived after the delay,
+// a second, identical request is sent, and whichever response arrives first is used.
+// The other request is cancelled. A good delay is around the 95th percentile latency of the API,
+// so that only the slowest calls are hedged.
+// Only GET and HEAD requests without a body are hedged, since the request may reach the server twice.
+func WithHedging(delay time.Duration) Option {
+	return func(cfg *config) {
+		cfg.hedgeDelay = delay
+	}
+}
+
+// hedgeable reports whether it is safe to send the request twice.
+func hedgeable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+// hedgeResult is the outcome of one of the hedged requests
+type hedgeResult struct {
+	resp *http.Response
+	err  error
+	n    int // index into the cancel functions
+}
+
+// hedgedDo sends the request with the doer, and sends it again if no response has arrived
+// after the delay. The first successful response is returned and the other request is cancelled.
+// If the first request fails before the hedge is sent, its error is returned right away;
+// otherwise the error of the request that failed last is returned.
+func hedgedDo(doer Doer, req *http.Request, delay time.Duration) (*http.Response, error) {
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	send := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		n := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := doer.Do(req.WithContext(ctx))
+			results <- hedgeResult{resp: resp, err: err, n: n}
+		}()
+	}
+
+	send()
+	inFlight := 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			send()
+			inFlight++
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				// Cancel the other request and discard its response if it arrives anyway.
+				// The context of the winner is cancelled when its body is closed.
+				for n, cancel := range cancels {
+					if n != r.n {
+						cancel()
+					}
+				}
+				go func(inFlight int) {
+					for ; inFlight > 0; inFlight-- {
+						discard((<-results).resp)
+					}
+				}(inFlight)
+				r.resp.Body = &cancelOnClose{ReadCloser: r.resp.Body, cancel: cancels[r.n]}
+				return r.resp, nil
+			}
+			cancels[r.n]()
+			if inFlight == 0 {
+				return nil, r.err
+			}
+		}
+	}
+}
+
+// cancelOnClose cancels a context when the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
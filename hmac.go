@@ -0,0 +1,175 @@
+package httpClient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// HMACConfig configures the signing of requests with an HMAC; see HMACSigner.
+type HMACConfig struct {
+	// Key is the shared secret key.
+	Key []byte
+
+	// Secret returns the shared secret key, if Key is not set, such as a secret of a SecretManager.
+	Secret SecretSource
+
+	// KeyID identifies the key to the API, sent in KeyIDHeader if both are set.
+	KeyID       string
+	KeyIDHeader string
+
+	// Header is the header carrying the signature. Defaults to "X-Signature".
+	Header string
+
+	// TimestampHeader is the header carrying the time of signing, in Unix seconds. Defaults to "X-Timestamp".
+	TimestampHeader string
+
+	// Hash is the hash function of the HMAC and of the body. Defaults to sha256.New.
+	Hash func() hash.Hash
+
+	// Base64 encodes the signature and body hash in standard base64 rather than hex.
+	Base64 bool
+
+	// Canonicalize returns the string that is signed, from the method, the path and query of the request,
+	// the timestamp and the encoded hash of the body. Defaults to the four joined with newlines.
+	Canonicalize func(method string, path string, timestamp string, bodyHash string) string
+
+	// MaxClockSkew, if set, corrects the timestamps for the difference between the local clock and the clock
+	// of the API, as told by the Date header of its responses, when the difference is larger than MaxClockSkew.
+	// This keeps the requests from being rejected as expired when the local clock drifts.
+	MaxClockSkew time.Duration
+}
+
+// HMACSigner returns middleware that signs the requests with an HMAC of the method, path, timestamp and body hash,
+// for partner APIs that require signed requests:
+//
+//	client := httpClient.New(httpClient.WithMiddleware(httpClient.HMACSigner(httpClient.HMACConfig{
+//		Key:    key,
+//		Header: "X-Partner-Signature",
+//	})))
+//
+// The signature is a CredentialProvider, added to the request like those of WithCredentials.
+// The body is read to be hashed. To avoid copying it, use a body that can be read again, such as a bytes.Reader,
+// or set WithRetry with a RetryPolicy.MaxAttempts above 1, which buffers the bodies up to
+// RetryPolicy.MaxBufferedBody so they can be. Pass the middleware to New: the clock skew is tracked across every
+// client created with the same Middleware value. If neither Key nor Secret is set, or the secret is empty,
+// the requests fail rather than be signed with an empty key.
+func HMACSigner(c HMACConfig) Middleware {
+	if len(c.Key) == 0 && c.Secret == nil {
+		return func(http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				closeBody(req)
+				return nil, errors.New("httpClient: no HMAC key: set HMACConfig.Key or HMACConfig.Secret")
+			})
+		}
+	}
+	if c.Header == "" {
+		c.Header = "X-Signature"
+	}
+	if c.TimestampHeader == "" {
+		c.TimestampHeader = "X-Timestamp"
+	}
+	if c.Hash == nil {
+		c.Hash = sha256.New
+	}
+	if c.Canonicalize == nil {
+		c.Canonicalize = func(method string, path string, timestamp string, bodyHash string) string {
+			return strings.Join([]string{method, path, timestamp, bodyHash}, "\n")
+		}
+	}
+	s := &hmacSigner{c: c}
+	return func(next http.RoundTripper) http.RoundTripper {
+		t := &credentialTransport{provider: s, base: next}
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			// Make the body readable by the signer without consuming it
+			r := req.Clone(req.Context())
+			if _, err := readBody(r); err != nil {
+				closeBody(req)
+				return nil, fmt.Errorf("httpClient: reading the body to sign: %w", err)
+			}
+			start := time.Now()
+			resp, err := t.RoundTrip(r)
+			s.observe(resp, start)
+			return resp, err
+		})
+	}
+}
+
+// hmacSigner is the CredentialProvider of HMACSigner
+type hmacSigner struct {
+	c HMACConfig
+
+	// skew is the time of the API minus the local time, in nanoseconds
+	skew atomic.Int64
+}
+
+// Credentials returns the headers with the signature of the request, signed now.
+func (s *hmacSigner) Credentials(req *http.Request) (http.Header, error) {
+	c := &s.c
+	key := c.Key
+	if len(key) == 0 && c.Secret != nil {
+		secret, err := c.Secret(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("httpClient: getting the HMAC key: %w", err)
+		}
+		key = []byte(secret)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("httpClient: the HMAC key is empty")
+	}
+
+	body, err := getBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: reading the body to sign: %w", err)
+	}
+	h := c.Hash()
+	h.Write(body)
+	bodyHash := c.encode(h.Sum(nil))
+
+	timestamp := strconv.FormatInt(time.Now().Add(time.Duration(s.skew.Load())).Unix(), 10)
+	mac := hmac.New(c.Hash, key)
+	mac.Write([]byte(c.Canonicalize(req.Method, req.URL.RequestURI(), timestamp, bodyHash)))
+
+	headers := http.Header{}
+	headers.Set(c.TimestampHeader, timestamp)
+	headers.Set(c.Header, c.encode(mac.Sum(nil)))
+	if c.KeyID != "" && c.KeyIDHeader != "" {
+		headers.Set(c.KeyIDHeader, c.KeyID)
+	}
+	return headers, nil
+}
+
+// observe corrects the clock skew from the Date of the response to a request sent at start, if MaxClockSkew is set.
+func (s *hmacSigner) observe(resp *http.Response, start time.Time) {
+	if s.c.MaxClockSkew <= 0 || resp == nil {
+		return
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	// The Date of the response was set about halfway through the call
+	d := date.Sub(start.Add(time.Since(start) / 2))
+	if d > s.c.MaxClockSkew || d < -s.c.MaxClockSkew {
+		s.skew.Store(int64(d))
+	} else {
+		s.skew.Store(0)
+	}
+}
+
+// encode encodes a hash in hex or base64.
+func (c *HMACConfig) encode(b []byte) string {
+	if c.Base64 {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return hex.EncodeToString(b)
+}
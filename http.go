@@ -9,8 +9,7 @@ import (
 	"strconv"
 	"time"
 
-	"contrib.go.opencensus.io/exporter/stackdriver/propagation"
-	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/metric/metricdata"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
@@ -30,11 +29,11 @@ var (
 	MethodTag = tag.MustNewKey("http_method")
 
 	// StatusTagCode is the HTTP response status code (404)
-	// Derived from the HTTP response.
+	// Derived from the HTTP response; 0 if the call failed without a response.
 	StatusTag = tag.MustNewKey("http_status_code")
 
 	// StatusClassTag is the HTTP response status class (2xx, 3xx, etc.)
-	// Derived from the HTTP response.
+	// Derived from the HTTP response; "error" if the call failed without a response.
 	StatusClassTag = tag.MustNewKey("http_status_class")
 
 	// APINameTag is name of the API called.
@@ -46,11 +45,20 @@ var (
 	// May indicate the application build or the runtime config.
 	// For Cloud Run, it should be the revision name.
 	VersionTag = tag.MustNewKey("version_name")
+
+	// ErrorClassTag is the kind of error when the call failed without a response:
+	// dns, connection_refused, connection_reset, timeout, context_canceled, tls or other.
+	// Empty if the call got a response.
+	ErrorClassTag = tag.MustNewKey("error_class")
+
+	// ProtocolTag is the version of HTTP of the response, such as HTTP/1.1 or HTTP/2.0.
+	// Empty if the call failed without a response.
+	ProtocolTag = tag.MustNewKey("http_protocol")
 )
 
 func init() {
-	registerLatencyMetric(outboundHTTPLatency, []tag.Key{MethodTag, APINameTag, StatusTag, StatusClassTag, VersionTag})
-	registerCounterMetric(outboundHTTPRequests, []tag.Key{MethodTag, APINameTag, StatusTag, StatusClassTag, VersionTag})
+	registerLatencyMetric(outboundHTTPLatency, []tag.Key{MethodTag, APINameTag, StatusTag, StatusClassTag, VersionTag, EndpointTag, ErrorClassTag, AttemptTag, OutcomeTag, ProtocolTag})
+	registerCounterMetric(outboundHTTPRequests, []tag.Key{MethodTag, APINameTag, StatusTag, StatusClassTag, VersionTag, EndpointTag, ErrorClassTag, AttemptTag, OutcomeTag, ProtocolTag})
 }
 
 // Do calls the http.Client.Do method with the provided request and returns the response.
@@ -60,37 +68,50 @@ func init() {
 // Separate errors are returned for failures in the http.Client.Do call, or the call to record metrics.
 // httpError can be nil and metricError can be populated (if the HTTP call succeeded, but we couldn't record metrics)
 // Similarly, httpError can be populated, but metricError can be nil (if HTTP call failed, but we recorded it in metrics).
+//
+// Do is a shorthand for New(...).Do(req); use a Client to configure more options.
 func Do(req *http.Request, apiName string, versionName string, timeout time.Duration) (response *http.Response, httpError error, metricError error) {
+	c := New(WithAPIName(apiName), WithVersion(versionName), WithTimeout(timeout))
+	response, err := c.Do(req)
+	httpError, metricError = splitError(err)
+	return response, httpError, metricError
+}
 
-	start := time.Now()
-	client := &http.Client{
-		Timeout: timeout,
-		Transport: &ochttp.Transport{
-			Propagation: &propagation.HTTPFormat{},
-		},
-	}
+// recordHTTPMetrics records latency and counter metrics to OpenCensus, with the tags from httpMetricTags.
+// The attachments, if any, are recorded as exemplars, such as the span of the call.
+// Additional measurements of the same call can be supplied in extra.
+func recordHTTPMetrics(ctx context.Context, mutators []tag.Mutator, latency time.Duration, attachments metricdata.Attachments, extra ...stats.Measurement) error {
 
-	response, httpError = client.Do(req)
-	timeTaken := time.Since(start)
+	ms := append([]stats.Measurement{
+		outboundHTTPLatency.M(latency.Milliseconds()),
+		outboundHTTPRequests.M(1),
+	}, extra...)
 
-	metricError = recordHTTPMetrics(req.Context(), req.Method, apiName, versionName, timeTaken, response)
+	return stats.RecordWithOptions(ctx,
+		stats.WithTags(mutators...),
+		stats.WithMeasurements(ms...),
+		stats.WithAttachments(attachments))
 
-	return response, httpError, metricError
 }
 
-// recordHTTPMetrics records latency and counter metrics to OpenCensus
-func recordHTTPMetrics(ctx context.Context, method string, apiName string, versionName string, latency time.Duration, resp *http.Response) error {
+// httpMetricTags returns the tags recorded with the latency and counter metrics of a call.
+// If the call failed without a response, the status code is 0, the status class is "error"
+// and the ErrorClassTag tells what went wrong.
+// Additional tags can be supplied in extraTags; they are applied after the package tags.
+func httpMetricTags(method string, apiName string, versionName string, resp *http.Response, err error, extraTags []tag.Mutator) []tag.Mutator {
 
 	var class string
 	var code int
+	var proto string
 
 	if resp != nil {
 		code = resp.StatusCode
-	} else {
-		code = 500
+		proto = resp.Proto
 	}
 
-	if code >= 100 && code <= 199 {
+	if resp == nil {
+		class = "error"
+	} else if code >= 100 && code <= 199 {
 		class = "1xx"
 	} else if code >= 200 && code <= 299 {
 		class = "2xx"
@@ -104,20 +125,16 @@ func recordHTTPMetrics(ctx context.Context, method string, apiName string, versi
 		class = "UNKNOWN"
 	}
 
-	err := stats.RecordWithTags(
-		ctx,
-		[]tag.Mutator{
-			tag.Insert(MethodTag, method),
-			tag.Insert(APINameTag, apiName),
-			tag.Insert(StatusTag, strconv.Itoa(code)),
-			tag.Insert(StatusClassTag, class),
-			tag.Insert(VersionTag, versionName),
-		},
-		outboundHTTPLatency.M(latency.Milliseconds()),
-		outboundHTTPRequests.M(1))
-
-	return err
-
+	mutators := []tag.Mutator{
+		tag.Insert(MethodTag, method),
+		tag.Insert(APINameTag, apiName),
+		tag.Insert(StatusTag, strconv.Itoa(code)),
+		tag.Insert(StatusClassTag, class),
+		tag.Insert(VersionTag, versionName),
+		tag.Insert(ErrorClassTag, classifyError(err)),
+		tag.Insert(ProtocolTag, proto),
+	}
+	return append(mutators, extraTags...)
 }
 
 // registerLatencyMetric is a helper function to register a stats.Measure with OpenCensus
@@ -129,13 +146,10 @@ func registerLatencyMetric(m stats.Measure, tags []tag.Key) error {
 		Name:        m.Name(),
 		TagKeys:     tags,
 		Description: m.Description(),
-		Aggregation: view.Distribution(0, 100, 200, 400, 1000, 2000, 4000),
+		Aggregation: view.Distribution(DefaultLatencyBuckets...),
 	}
 
-	if err := view.Register(v); err != nil {
-		return err
-	}
-	return nil
+	return registerView(v)
 }
 
 // registerCounterMetric is a helper function to register a stats.Measure with OpenCensus
@@ -150,8 +164,35 @@ func registerCounterMetric(m stats.Measure, tags []tag.Key) error {
 		Aggregation: view.Count(),
 	}
 
-	if err := view.Register(v); err != nil {
-		return err
+	return registerView(v)
+}
+
+// registerGaugeMetric is a helper function to register a stats.Measure with OpenCensus
+// This must happen before you start recording metrics.
+// This function registers a gauge metric, that reports the last value recorded, such as a queue length.
+func registerGaugeMetric(m stats.Measure, tags []tag.Key) error {
+	v := &view.View{
+		Measure:     m,
+		Name:        m.Name(),
+		TagKeys:     tags,
+		Description: m.Description(),
+		Aggregation: view.LastValue(),
+	}
+
+	return registerView(v)
+}
+
+// registerSizeMetric is a helper function to register a stats.Measure with OpenCensus
+// This must happen before you start recording metrics.
+// This function registers a size-type metric, that measures the size of request and response bodies
+func registerSizeMetric(m stats.Measure, tags []tag.Key) error {
+	v := &view.View{
+		Measure:     m,
+		Name:        m.Name(),
+		TagKeys:     tags,
+		Description: m.Description(),
+		Aggregation: view.Distribution(DefaultSizeBuckets...),
 	}
-	return nil
+
+	return registerView(v)
 }
@@ -0,0 +1,269 @@
+package httpClient
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// OpenCensus metric definition for time to first byte
+	outboundHTTPTTFB = stats.Int64("http_outbound_ttfb", "Time from sending the request to receiving the first byte of the response from the external HTTP API", stats.UnitMilliseconds)
+
+	// OpenCensus metric definitions for the phases of setting up a connection
+	outboundHTTPDNSLatency     = stats.Int64("http_outbound_dns_latency", "Time spent resolving the host name of the external HTTP API", stats.UnitMilliseconds)
+	outboundHTTPConnectLatency = stats.Int64("http_outbound_connect_latency", "Time spent opening a TCP connection to the external HTTP API", stats.UnitMilliseconds)
+	outboundHTTPTLSLatency     = stats.Int64("http_outbound_tls_latency", "Time spent on the TLS handshake with the external HTTP API", stats.UnitMilliseconds)
+
+	// OpenCensus metric definitions for the connections used to call the API
+	outboundHTTPConnections = stats.Int64("http_outbound_connections", "Connections used for calls to the external HTTP API", stats.UnitDimensionless)
+	outboundHTTPConnIdle    = stats.Int64("http_outbound_conn_idle_time", "Time a reused connection to the external HTTP API was idle in the pool", stats.UnitMilliseconds)
+
+	// ConnReuseTag tells whether the connection used for the call was "reused" from the pool,
+	// or "new". Recorded with the http_outbound_connections metric; count the new connections
+	// per API to find clients that don't reuse connections. There is no metric of the size of the idle pool,
+	// which net/http doesn't expose: a pool that is too small shows as new connections, and one that is
+	// larger than needed as a long http_outbound_conn_idle_time.
+	ConnReuseTag = tag.MustNewKey("conn_reuse")
+)
+
+func init() {
+	tags := []tag.Key{MethodTag, APINameTag, StatusTag, StatusClassTag, VersionTag, EndpointTag}
+	registerLatencyMetric(outboundHTTPTTFB, tags)
+	registerLatencyMetric(outboundHTTPDNSLatency, tags)
+	registerLatencyMetric(outboundHTTPConnectLatency, tags)
+	registerLatencyMetric(outboundHTTPTLSLatency, tags)
+	registerCounterMetric(outboundHTTPConnections, []tag.Key{APINameTag, VersionTag, EndpointTag, ConnReuseTag})
+	registerLatencyMetric(outboundHTTPConnIdle, []tag.Key{APINameTag, VersionTag, EndpointTag})
+
+	// The time to first byte is the time the server spent processing the request (plus the network round trip),
+	// which is also published under a name that fits in with the other phases
+	registerView(&view.View{
+		Measure:     outboundHTTPTTFB,
+		Name:        "http_outbound_server_latency",
+		TagKeys:     tags,
+		Description: "Time the external HTTP API spent processing the request, measured as the time to first byte",
+		Aggregation: view.Distribution(DefaultLatencyBuckets...),
+	})
+}
+
+// phases records when the phases of an HTTP request happened, using httptrace hooks, and adds
+// the main phases to the spans of the HTTP call as events.
+// The first time of each event is kept, since hedged requests share the hooks.
+type phases struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+
+	// conn describes the connection the request was sent on, if gotConn
+	gotConn bool
+	conn    httptrace.GotConnInfo
+
+	// span is the span of the HTTP call started by the OpenCensus transport, if gotSpan;
+	// ocSpan and otelSpan are the spans the events of the phases are added to
+	gotSpan  bool
+	span     trace.SpanContext
+	ocSpan   *trace.Span
+	otelSpan oteltrace.Span
+}
+
+// phasesKey is the context key of the phases of the request
+type phasesKey struct{}
+
+// set sets *t to now, unless it is already set, and reports whether it set it.
+func (p *phases) set(t *time.Time) bool {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t.IsZero() {
+		*t = now
+		return true
+	}
+	return false
+}
+
+// event sets *t to now, unless it is already set, and adds the event to the spans of the HTTP call.
+func (p *phases) event(name string, t *time.Time) {
+	if !p.set(t) {
+		return
+	}
+	p.mu.Lock()
+	ocSpan, otelSpan := p.ocSpan, p.otelSpan
+	p.mu.Unlock()
+	if ocSpan != nil {
+		ocSpan.Annotate(nil, name)
+	}
+	if otelSpan != nil {
+		otelSpan.AddEvent(name)
+	}
+}
+
+// setConn keeps the first connection the request was sent on.
+func (p *phases) setConn(info httptrace.GotConnInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.gotConn {
+		p.gotConn = true
+		p.conn = info
+	}
+}
+
+// connReuse returns the value of the ConnReuseTag, or "" if no connection was used.
+func (p *phases) connReuse() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case !p.gotConn:
+		return ""
+	case p.conn.Reused:
+		return "reused"
+	default:
+		return "new"
+	}
+}
+
+// trace returns the request with httptrace hooks that record the phases.
+func (p *phases) trace(req *http.Request) *http.Request {
+	ct := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { p.event("dns_start", &p.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { p.event("dns_done", &p.dnsDone) },
+		ConnectStart:         func(string, string) { p.set(&p.connectStart) },
+		ConnectDone:          func(string, string, error) { p.event("connect_done", &p.connectDone) },
+		TLSHandshakeStart:    func() { p.set(&p.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.event("tls_done", &p.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { p.set(&p.wroteRequest) },
+		GotFirstResponseByte: func() { p.event("first_byte", &p.firstByte) },
+		GotConn:              p.setConn,
+	}
+	ctx := context.WithValue(req.Context(), phasesKey{}, p)
+	return req.WithContext(httptrace.WithClientTrace(ctx, ct))
+}
+
+// spanCapture is the transport under the OpenCensus and OpenTelemetry transports, which keeps the spans
+// they started in the phases of the request, so the metrics can link to the trace and the phases can be
+// added to the spans as events.
+type spanCapture struct {
+	base http.RoundTripper
+}
+
+func (t *spanCapture) RoundTrip(req *http.Request) (*http.Response, error) {
+	if p, ok := req.Context().Value(phasesKey{}).(*phases); ok {
+		otelSpan := oteltrace.SpanFromContext(req.Context())
+		if !otelSpan.SpanContext().IsValid() {
+			otelSpan = nil
+		}
+		p.setSpans(trace.FromContext(req.Context()), otelSpan)
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// setSpans keeps the first spans the request was sent with.
+func (p *phases) setSpans(ocSpan *trace.Span, otelSpan oteltrace.Span) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ocSpan == nil && p.otelSpan == nil {
+		p.ocSpan = ocSpan
+		p.otelSpan = otelSpan
+	}
+	if !p.gotSpan && ocSpan != nil {
+		p.gotSpan = true
+		p.span = ocSpan.SpanContext()
+	}
+}
+
+// attachments returns the span of the call as an exemplar attachment, if the span is sampled,
+// so that the latency distribution links to the trace in Cloud Monitoring.
+func (p *phases) attachments() metricdata.Attachments {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.gotSpan || !p.span.IsSampled() {
+		return nil
+	}
+	return metricdata.Attachments{metricdata.AttachmentKeySpanContext: p.span}
+}
+
+// measurements returns the phase metrics to record.
+func (p *phases) measurements() []stats.Measurement {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ms []stats.Measurement
+	add := func(m *stats.Int64Measure, start time.Time, end time.Time) {
+		if !start.IsZero() && !end.IsZero() {
+			ms = append(ms, m.M(end.Sub(start).Milliseconds()))
+		}
+	}
+	add(outboundHTTPDNSLatency, p.dnsStart, p.dnsDone)
+	add(outboundHTTPConnectLatency, p.connectStart, p.connectDone)
+	add(outboundHTTPTLSLatency, p.tlsStart, p.tlsDone)
+	add(outboundHTTPTTFB, p.wroteRequest, p.firstByte)
+	if p.gotConn {
+		ms = append(ms, outboundHTTPConnections.M(1))
+		if p.conn.WasIdle {
+			ms = append(ms, outboundHTTPConnIdle.M(p.conn.IdleTime.Milliseconds()))
+		}
+	}
+	return ms
+}
+
+// breakdown returns the time spent in each phase of the request, for logging.
+func (p *phases) breakdown() slog.Value {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var attrs []slog.Attr
+	add := func(name string, start time.Time, end time.Time) {
+		if !start.IsZero() && !end.IsZero() {
+			attrs = append(attrs, slog.Duration(name, end.Sub(start)))
+		}
+	}
+	add("dns", p.dnsStart, p.dnsDone)
+	add("connect", p.connectStart, p.connectDone)
+	add("tls", p.tlsStart, p.tlsDone)
+	add("ttfb", p.wroteRequest, p.firstByte)
+	if p.gotConn {
+		attrs = append(attrs, slog.Bool("reused", p.conn.Reused))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// traceID returns the trace ID of the spans of the request, or "".
+func (p *phases) traceID() string {
+	traceID, _, _ := p.traceContext()
+	return traceID
+}
+
+// traceContext returns the trace and span IDs of the span of the request and whether it is sampled,
+// or "" if it has no span.
+func (p *phases) traceContext() (traceID string, spanID string, sampled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.ocSpan != nil:
+		sc := p.ocSpan.SpanContext()
+		return sc.TraceID.String(), sc.SpanID.String(), sc.IsSampled()
+	case p.otelSpan != nil:
+		sc := p.otelSpan.SpanContext()
+		return sc.TraceID().String(), sc.SpanID().String(), sc.IsSampled()
+	}
+	return "", "", false
+}
@@ -0,0 +1,60 @@
+package httpClient
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// IdempotencyKeyHeader is the header that carries the idempotency key of a request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// WithIdempotencyKey attaches a generated Idempotency-Key header to requests that don't have one.
+// The same key is sent on every retry of a call, so an upstream that supports idempotency keys
+// can detect duplicates. Requests with an idempotency key are retried even if the method is not idempotent.
+func WithIdempotencyKey() Option {
+	return func(cfg *config) {
+		cfg.idempotencyKey = true
+	}
+}
+
+// isIdempotent reports whether the request can safely be sent more than once:
+// the method is idempotent as defined by RFC 7231, or the request has an idempotency key.
+// This matches the rule net/http uses when it retries requests on a broken connection.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := req.Header[IdempotencyKeyHeader]
+	if !ok {
+		_, ok = req.Header["X-Idempotency-Key"]
+	}
+	return ok
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("httpClient: generating UUID: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// withIdempotencyKey returns the request with an Idempotency-Key header,
+// copying the request if the header has to be added.
+func withIdempotencyKey(req *http.Request) (*http.Request, error) {
+	if req.Header.Get(IdempotencyKeyHeader) != "" {
+		return req, nil
+	}
+	key, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.Header.Set(IdempotencyKeyHeader, key)
+	return r, nil
+}
@@ -0,0 +1,28 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/idtoken"
+	"google.golang.org/api/option"
+)
+
+// WithIDToken authenticates the calls with a Google-signed ID token for the audience, as required to call
+// a Cloud Run service or Cloud Function that doesn't allow unauthenticated calls. The audience is the URL of
+// the service, such as "https://my-service-abc123-uc.a.run.app". On Cloud Run, GKE and Compute Engine
+// the token is fetched from the metadata server; elsewhere a service account key is needed, found with the
+// Application Default Credentials or passed in opts, such as option.WithCredentialsFile.
+//
+// The token is cached and refreshed like with WithTokenSource. If the token source can't be created,
+// Client.Do returns the error. Pass the option to New: the token is cached across every client created with
+// the same Option value.
+func WithIDToken(audience string, opts ...option.ClientOption) Option {
+	ts, err := idtoken.NewTokenSource(context.Background(), audience, opts...)
+	if err != nil {
+		return func(cfg *config) {
+			cfg.err = fmt.Errorf("httpClient: creating ID token source for %q: %w", audience, err)
+		}
+	}
+	return WithTokenSource(ts)
+}
@@ -0,0 +1,45 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+)
+
+// WithImpersonation authenticates the calls with an access token of the service account c.TargetPrincipal,
+// generated with the IAM Credentials API by the caller's identity, so that the calls to an API are made with
+// the least privileges they need rather than with the workload's own service account. The caller's identity,
+// from the Application Default Credentials or opts, needs the Service Account Token Creator role on the target.
+// For example, to read from BigQuery as a read-only service account:
+//
+//	client := httpClient.New(httpClient.WithImpersonation(impersonate.CredentialsConfig{
+//		TargetPrincipal: "bq-reader@my-project.iam.gserviceaccount.com",
+//		Scopes:          []string{"https://www.googleapis.com/auth/bigquery.readonly"},
+//	}))
+//
+// The token is cached and refreshed like with WithTokenSource. If the token source can't be created,
+// Client.Do returns the error. Set it per API, with New or a Registry.
+func WithImpersonation(c impersonate.CredentialsConfig, opts ...option.ClientOption) Option {
+	ts, err := impersonate.CredentialsTokenSource(context.Background(), c, opts...)
+	if err != nil {
+		return func(cfg *config) {
+			cfg.err = fmt.Errorf("httpClient: impersonating %q: %w", c.TargetPrincipal, err)
+		}
+	}
+	return WithTokenSource(ts)
+}
+
+// WithImpersonatedIDToken authenticates the calls with an ID token of the service account c.TargetPrincipal
+// for the audience c.Audience, generated with the IAM Credentials API by the caller's identity, such as to call
+// a Cloud Run service as a service account that is allowed to invoke it. See WithImpersonation and WithIDToken.
+func WithImpersonatedIDToken(c impersonate.IDTokenConfig, opts ...option.ClientOption) Option {
+	ts, err := impersonate.IDTokenSource(context.Background(), c, opts...)
+	if err != nil {
+		return func(cfg *config) {
+			cfg.err = fmt.Errorf("httpClient: impersonating %q for an ID token: %w", c.TargetPrincipal, err)
+		}
+	}
+	return WithTokenSource(ts)
+}
@@ -0,0 +1,116 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definition for calls in flight
+	outboundHTTPInFlight = stats.Int64("http_outbound_inflight", "Calls in flight to the external HTTP API", stats.UnitDimensionless)
+
+	// OpenCensus metric definition for the slots taken of the limit set with WithMaxInFlight
+	outboundHTTPInFlightLimitUsed = stats.Int64("http_outbound_inflight_limit_used", "Requests holding a slot of the in-flight limit of the external HTTP APIs", stats.UnitDimensionless)
+
+	// inFlightCounts holds the number of calls in flight per API name, for the whole process
+	inFlightCounts = newKeyed(func(string) *int64 { return new(int64) })
+)
+
+func init() {
+	registerGaugeMetric(outboundHTTPInFlight, []tag.Key{APINameTag})
+	registerGaugeMetric(outboundHTTPInFlightLimitUsed, []tag.Key{})
+}
+
+// trackInFlight counts a call to the API as in flight and records the http_outbound_inflight metric.
+// The returned function must be called when the call completes.
+func trackInFlight(ctx context.Context, apiName string) (done func(), err error) {
+	n := inFlightCounts.get(apiName)
+	mutators := []tag.Mutator{tag.Upsert(APINameTag, apiName)}
+	err = stats.RecordWithTags(ctx, mutators, outboundHTTPInFlight.M(atomic.AddInt64(n, 1)))
+	return func() {
+		// The call has completed, so there is nobody left to return the error to
+		_ = stats.RecordWithTags(ctx, mutators, outboundHTTPInFlight.M(atomic.AddInt64(n, -1)))
+	}, err
+}
+
+// WithMaxInFlight limits the number of HTTP requests in flight across all APIs to max,
+// so that a misbehaving dependency can't exhaust the file descriptors of the process.
+// Requests wait for a free slot, or until their context is done. A request holds its slot until
+// its response body is closed, since that is when the connection is given up. Every retry is a request.
+// Pass the option to New: the limit is shared by every client created with the same Option value.
+// The number of slots taken is recorded in the http_outbound_inflight_limit_used metric, rather than in
+// http_outbound_inflight, which counts the calls in flight per API whether they are limited or not.
+// If max is not positive, Client.Do returns an error.
+func WithMaxInFlight(max int) Option {
+	if max <= 0 {
+		return func(cfg *config) {
+			cfg.err = fmt.Errorf("httpClient: invalid limit of %d requests in flight", max)
+		}
+	}
+	s := &inFlightLimit{slots: make(chan struct{}, max)}
+	return func(cfg *config) {
+		cfg.inFlight = s
+	}
+}
+
+// inFlightLimit is a semaphore for HTTP requests
+type inFlightLimit struct {
+	slots chan struct{}
+}
+
+// acquire waits for a free slot, or until the context is done.
+func (l *inFlightLimit) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire, and records the number of slots taken if record is set.
+func (l *inFlightLimit) release(record bool) error {
+	<-l.slots
+	if !record {
+		return nil
+	}
+	// The request may be long gone when its body is closed, so its context isn't used
+	return l.record(context.Background())
+}
+
+// record records the number of slots taken.
+func (l *inFlightLimit) record(ctx context.Context) error {
+	return stats.RecordWithTags(ctx, nil, outboundHTTPInFlightLimitUsed.M(int64(len(l.slots))))
+}
+
+// releaseOnClose frees the slot taken by acquire when the response body is closed,
+// or right away if there is no response, and records the number of slots taken if record is set.
+func (l *inFlightLimit) releaseOnClose(resp *http.Response, record bool) {
+	// The call has completed, so there is nobody left to return the error to
+	release := func() { _ = l.release(record) }
+	if resp == nil {
+		release()
+		return
+	}
+	resp.Body = &onClose{ReadCloser: resp.Body, fn: release}
+}
+
+// onClose calls fn once, when the body is first closed
+type onClose struct {
+	io.ReadCloser
+	once sync.Once
+	fn   func()
+}
+
+func (c *onClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.once.Do(c.fn)
+	return err
+}
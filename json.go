@@ -0,0 +1,83 @@
+package httpClient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// GetJSON sends a GET request to the URL with the client and decodes the JSON response into a T.
+// A relative URL is resolved against the base URL of the client.
+// A response with a status code outside 2xx is returned as a *StatusError, wrapped in a *GoogleAPIError
+// if the body is the error of a Google API.
+func GetJSON[T any](ctx context.Context, c *Client, url string, opts ...Option) (T, error) {
+	return DoJSON[T](ctx, c, http.MethodGet, url, nil, opts...)
+}
+
+// PostJSON encodes body as JSON, sends it in a POST request to the URL with the client and
+// decodes the JSON response into a T.
+func PostJSON[T any](ctx context.Context, c *Client, url string, body any, opts ...Option) (T, error) {
+	return DoJSON[T](ctx, c, http.MethodPost, url, body, opts...)
+}
+
+// PutJSON encodes body as JSON, sends it in a PUT request to the URL with the client and
+// decodes the JSON response into a T.
+func PutJSON[T any](ctx context.Context, c *Client, url string, body any, opts ...Option) (T, error) {
+	return DoJSON[T](ctx, c, http.MethodPut, url, body, opts...)
+}
+
+// DoJSON sends a request with the method to the URL with the client and decodes the JSON response into a T.
+// If body is not nil, it is encoded as JSON and sent as the request body with Content-Type application/json.
+// An empty response body, such as from a 204 No Content, leaves the result as the zero value of T.
+// A response with a status code outside 2xx is returned as a *StatusError, wrapped in a *GoogleAPIError
+// if the body is the error of a Google API.
+func DoJSON[T any](ctx context.Context, c *Client, method string, url string, body any, opts ...Option) (T, error) {
+	var result T
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return result, fmt.Errorf("httpClient: encoding request body: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// An error that only reports failing to record metrics doesn't stop the response
+	// from being decoded; it is returned together with the result.
+	resp, err := c.Do(req, opts...)
+	if resp == nil || errors.Is(err, ErrHTTP) {
+		return result, err
+	}
+	defer resp.Body.Close()
+	metricErr := err
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result, responseError(resp)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return result, fmt.Errorf("httpClient: reading response body: %w", err)
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return result, metricErr
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return result, fmt.Errorf("httpClient: decoding response body: %w", err)
+	}
+	return result, metricErr
+}
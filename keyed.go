@@ -0,0 +1,28 @@
+package httpClient
+
+import "sync"
+
+// keyed holds one value per key, usually per API name, created on first use.
+// It is safe for concurrent use by multiple goroutines.
+type keyed[T any] struct {
+	mu     sync.Mutex
+	values map[string]T
+	create func(key string) T
+}
+
+// newKeyed returns a keyed that calls create to make the value for a new key.
+func newKeyed[T any](create func(key string) T) *keyed[T] {
+	return &keyed[T]{values: map[string]T{}, create: create}
+}
+
+// get returns the value for the key, creating it if needed.
+func (k *keyed[T]) get(key string) T {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	v, ok := k.values[key]
+	if !ok {
+		v = k.create(key)
+		k.values[key] = v
+	}
+	return v
+}
@@ -0,0 +1,60 @@
+// Package lite calls HTTP services with a timeout and trace propagation, like httpClient.Do,
+// but without recording metrics. It doesn't depend on OpenCensus or the Stackdriver exporter,
+// which keeps small tools that only want the convenience of the call small.
+//
+// The trace context of OpenTelemetry is propagated in the W3C traceparent header, which Google Cloud services
+// accept, unless the Client has another Propagator.
+// Use httpClient when the metrics, retries or other features are needed.
+package lite
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// DefaultTimeout is the timeout used by a Client with no Timeout.
+const DefaultTimeout = 30 * time.Second
+
+// Client calls HTTP services with a timeout and trace propagation.
+// The zero value is ready to use. A Client is safe for concurrent use by multiple goroutines.
+type Client struct {
+	// Timeout is the timeout for the HTTP call, including reading the response body.
+	// Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	// Transport is used to make the HTTP call. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// Propagator puts the trace context on the outbound requests. Defaults to DefaultPropagator;
+	// set it to otel.GetTextMapPropagator() to use the global propagator.
+	Propagator propagation.TextMapPropagator
+}
+
+// DefaultPropagator is the propagator used by a Client with no Propagator: the W3C Trace Context.
+var DefaultPropagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// Do sends the request with the timeout and returns the response.
+// It is a shorthand for (&Client{Timeout: timeout}).Do(req).
+func Do(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	return (&Client{Timeout: timeout}).Do(req)
+}
+
+// Do sends the request and returns the response. The trace context of the request context
+// is propagated on the outbound request.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	propagator := c.Propagator
+	if propagator == nil {
+		propagator = DefaultPropagator
+	}
+	req = req.Clone(req.Context())
+	propagator.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+
+	client := &http.Client{Timeout: timeout, Transport: c.Transport}
+	return client.Do(req)
+}
@@ -0,0 +1,208 @@
+package httpClient
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+)
+
+// RedactedValue replaces the redacted values in the logs and captured calls; see Redactor.
+const RedactedValue = "REDACTED"
+
+// DefaultRedactedHeaders are the headers redacted by WithRequestLogging when RequestLogConfig.RedactHeaders is not set.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// RequestLogConfig configures the logging of calls; see WithRequestLogging.
+type RequestLogConfig struct {
+	// Level is the level of the log records of successful calls. Failed calls are logged at slog.LevelWarn,
+	// or at Level if it is higher. Defaults to slog.LevelInfo.
+	Level slog.Level
+
+	// Headers logs the request and response headers.
+	Headers bool
+
+	// RedactHeaders are the headers whose values are replaced with RedactedValue.
+	// Defaults to DefaultRedactedHeaders. Ignored if WithRedactor is set.
+	RedactHeaders []string
+
+	// RedactQuery are the query parameters whose values are replaced with RedactedValue, such as "key" or "token".
+	// Ignored if WithRedactor is set.
+	RedactQuery []string
+
+	// SampleSuccesses logs about 1 in SampleSuccesses of the successful attempts, chosen at random, so that
+	// logging can stay on for high-volume APIs. Failed attempts are always logged. The records of sampled
+	// attempts have a sampled attribute with the value of SampleSuccesses, to scale counts made from the logs.
+	// 0 or 1 logs every attempt.
+	SampleSuccesses int
+
+	// CloudLogging formats the records for Cloud Logging, for a JSON handler writing to the standard output
+	// on Cloud Run or GKE: the method, URL, status, latency and sizes are in an httpRequest group, which the Logs
+	// Explorer displays like the request logs, and the trace and span of the attempt are in the
+	// logging.googleapis.com/trace and logging.googleapis.com/spanId fields, which link the record to the trace.
+	CloudLogging bool
+
+	// TraceProject is the project of the traces linked by CloudLogging. Defaults to the project of the
+	// metadata server; the records are not linked to the traces outside of Google Cloud if it is not set.
+	TraceProject string
+}
+
+// WithRequestLogging logs every attempt of a call with the logger set with WithLogger, or a sample of the
+// successful ones if RequestLogConfig.SampleSuccesses is set: the method, URL, status, latency and sizes,
+// and the headers if RequestLogConfig.Headers is set. Sensitive headers and query parameters
+// are redacted, with the Redactor set with WithRedactor if any. The user info of the URL is always redacted.
+func WithRequestLogging(c RequestLogConfig) Option {
+	if c.RedactHeaders == nil {
+		c.RedactHeaders = DefaultRedactedHeaders
+	}
+	return func(cfg *config) {
+		cfg.requestLog = &c
+	}
+}
+
+// logAttempt logs an attempt of the call sent to ep (or nil) that returned resp and err.
+func (cl *call) logAttempt(req *http.Request, ep *endpoint, ph *phases, resp *http.Response, err error, latency time.Duration, requestBytes int64) {
+	c := cl.cfg.requestLog
+	level := c.Level
+	success := cl.cfg.outcome(resp, err) == "success"
+	if !success && level < slog.LevelWarn {
+		level = slog.LevelWarn
+	}
+	sampled := success && c.SampleSuccesses > 1
+	if sampled && randFloat64()*float64(c.SampleSuccesses) >= 1 {
+		return
+	}
+	log := cl.cfg.log()
+	ctx := context.WithoutCancel(req.Context())
+	if !log.Enabled(ctx, level) {
+		return
+	}
+	r := cl.cfg.redaction()
+
+	attrs := []slog.Attr{
+		slog.String("api", cl.cfg.apiName),
+		slog.Int("attempt", cl.attempt),
+	}
+	if c.CloudLogging {
+		attrs = append(attrs, cloudLoggingAttrs(c, req, r, ph, resp, latency, requestBytes)...)
+	} else {
+		attrs = append(attrs,
+			slog.String("method", req.Method),
+			slog.String("url", r.URL(req.URL)),
+			slog.Duration("latency", latency),
+			slog.Int64("request_bytes", requestBytes))
+	}
+	if ep != nil {
+		attrs = append(attrs, slog.String("endpoint", ep.name))
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if sampled {
+		attrs = append(attrs, slog.Int("sampled", c.SampleSuccesses))
+	}
+	if c.Headers {
+		attrs = append(attrs, slog.Any("request_headers", r.Headers(req.Header)))
+	}
+	if resp != nil {
+		if !c.CloudLogging {
+			attrs = append(attrs,
+				slog.Int("status", resp.StatusCode),
+				slog.Int64("response_bytes", resp.ContentLength))
+		}
+		if c.Headers {
+			attrs = append(attrs, slog.Any("response_headers", r.Headers(resp.Header)))
+		}
+		if body := errorBody(resp); body != "" {
+			attrs = append(attrs, slog.String("response_body", body))
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", r.errorString(req.URL, err)))
+	}
+	log.LogAttrs(ctx, level, "httpClient: call", attrs...)
+}
+
+// cloudLoggingAttrs returns the httpRequest group and the trace fields of a record of an attempt, as read
+// by Cloud Logging from structured logs.
+func cloudLoggingAttrs(c *RequestLogConfig, req *http.Request, r *Redactor, ph *phases, resp *http.Response, latency time.Duration, requestBytes int64) []slog.Attr {
+	// Sizes are int64 values encoded as JSON strings, and the latency a duration in seconds, such as "0.25s"
+	httpRequest := []any{
+		slog.String("requestMethod", req.Method),
+		slog.String("requestUrl", r.URL(req.URL)),
+		slog.String("requestSize", strconv.FormatInt(requestBytes, 10)),
+		slog.String("latency", strconv.FormatFloat(latency.Seconds(), 'f', -1, 64)+"s"),
+		slog.String("protocol", req.Proto),
+	}
+	if resp != nil {
+		httpRequest = append(httpRequest, slog.Int("status", resp.StatusCode))
+		if resp.ContentLength >= 0 {
+			httpRequest = append(httpRequest, slog.String("responseSize", strconv.FormatInt(resp.ContentLength, 10)))
+		}
+	}
+	attrs := []slog.Attr{slog.Group("httpRequest", httpRequest...)}
+
+	traceID, spanID, sampled := ph.traceContext()
+	project := c.TraceProject
+	if project == "" {
+		project = metadataProjectID()
+	}
+	if traceID != "" && project != "" {
+		attrs = append(attrs,
+			slog.String("logging.googleapis.com/trace", "projects/"+project+"/traces/"+traceID),
+			slog.String("logging.googleapis.com/spanId", spanID),
+			slog.Bool("logging.googleapis.com/trace_sampled", sampled))
+	}
+	return attrs
+}
+
+// metadataProjectID returns the project of the metadata server, or "" outside of Google Cloud.
+var metadataProjectID = sync.OnceValue(func() string {
+	if !metadata.OnGCE() {
+		return ""
+	}
+	id, _ := metadata.ProjectID()
+	return id
+})
+
+// WithSlowRequestLogging logs the attempts of a call that take longer than the threshold at slog.LevelWarn,
+// with the time spent in each phase of the request and the trace ID, to find the cause of tail latency
+// without logging every call. Set it per API, with New or a Registry.
+func WithSlowRequestLogging(threshold time.Duration) Option {
+	return func(cfg *config) {
+		cfg.slowThreshold = threshold
+	}
+}
+
+// logSlow logs an attempt of the call that took longer than the threshold.
+func (cl *call) logSlow(req *http.Request, ep *endpoint, ph *phases, resp *http.Response, err error, latency time.Duration) {
+	attrs := []slog.Attr{
+		slog.String("api", cl.cfg.apiName),
+		slog.String("method", req.Method),
+		slog.String("url", cl.cfg.redaction().URL(req.URL)),
+		slog.Int("attempt", cl.attempt),
+		slog.Duration("latency", latency),
+		slog.Duration("threshold", cl.cfg.slowThreshold),
+		slog.Any("phases", ph.breakdown()),
+	}
+	if ep != nil {
+		attrs = append(attrs, slog.String("endpoint", ep.name))
+	}
+	if traceID := ph.traceID(); traceID != "" {
+		attrs = append(attrs, slog.String("trace_id", traceID))
+	}
+	if id := RequestIDFromContext(req.Context()); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if resp != nil {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", cl.cfg.redaction().errorString(req.URL, err)))
+	}
+	cl.cfg.log().LogAttrs(context.WithoutCancel(req.Context()), slog.LevelWarn, "httpClient: slow call", attrs...)
+}
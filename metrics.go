@@ -0,0 +1,155 @@
+package httpClient
+
+import (
+	"fmt"
+	"sync"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// DefaultLatencyBuckets are the bucket boundaries, in milliseconds, of the latency distributions.
+var DefaultLatencyBuckets = []float64{0, 100, 200, 400, 1000, 2000, 4000}
+
+var (
+	viewsMu sync.Mutex
+
+	// views holds the views registered by this package, by name without the prefix
+	views = map[string]*view.View{}
+
+	// prefix is the prefix of the view names; see SetMetricPrefix
+	prefix string
+)
+
+// callViews are the names of the views recorded with the tags of a call, which RegisterTagKeys extends.
+var callViews = []string{
+	"http_outbound_latency",
+	"http_outbound_count",
+	"http_outbound_request_bytes",
+	"http_outbound_response_bytes",
+	"http_outbound_ttfb",
+	"http_outbound_server_latency",
+	"http_outbound_dns_latency",
+	"http_outbound_connect_latency",
+	"http_outbound_tls_latency",
+}
+
+// registerView registers the view with OpenCensus and keeps it, so it can be changed later.
+func registerView(v *view.View) error {
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+	name := v.Name
+	v.Name = prefix + name
+	if err := view.Register(v); err != nil {
+		return err
+	}
+	views[name] = v
+	return nil
+}
+
+// replaceView replaces the registered view named name (without the prefix) with v.
+// The caller must hold viewsMu.
+func replaceView(name string, v *view.View) error {
+	if old, ok := views[name]; ok {
+		view.Unregister(old)
+	}
+	if err := view.Register(v); err != nil {
+		return err
+	}
+	views[name] = v
+	return nil
+}
+
+// SetDistributionBuckets changes the bucket boundaries of a distribution metric of this package,
+// such as http_outbound_latency, for example to resolve latencies below 10ms:
+//
+//	httpClient.SetDistributionBuckets("http_outbound_latency", 0, 1, 2, 5, 10, 25, 50, 100, 250, 1000)
+//
+// Call it when the program starts, before any calls are made: the data already recorded for the metric is discarded.
+func SetDistributionBuckets(metricName string, bounds ...float64) error {
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+
+	old, ok := views[metricName]
+	if !ok {
+		return fmt.Errorf("httpClient: no metric named %q", metricName)
+	}
+	if old.Aggregation.Type != view.AggTypeDistribution {
+		return fmt.Errorf("httpClient: metric %q is not a distribution", metricName)
+	}
+
+	v := *old
+	v.Aggregation = view.Distribution(bounds...)
+	return replaceView(metricName, &v)
+}
+
+// RegisterTagKeys adds the tag keys to the metrics recorded for every call, such as http_outbound_latency
+// and http_outbound_count, so that the values supplied with WithTags or WithExtraTag, or set on the
+// request context with tag.New, are kept. For example, to break the metrics down by tenant:
+//
+//	tenantKey := tag.MustNewKey("tenant")
+//	httpClient.RegisterTagKeys(tenantKey)
+//	...
+//	client.Do(req, httpClient.WithExtraTag(tenantKey, tenantID))
+//
+// Call it when the program starts, before any calls are made: the data already recorded for the metrics is discarded.
+// Keep the number of distinct values small, since every combination of tag values is a separate time series.
+func RegisterTagKeys(keys ...tag.Key) error {
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+
+	for _, name := range callViews {
+		old, ok := views[name]
+		if !ok {
+			continue
+		}
+		v := *old
+		v.TagKeys = addTagKeys(old.TagKeys, keys)
+		if len(v.TagKeys) == len(old.TagKeys) {
+			continue
+		}
+		if err := replaceView(name, &v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTagKeys returns a new slice with the keys that are not already in existing appended.
+func addTagKeys(existing []tag.Key, keys []tag.Key) []tag.Key {
+	result := append([]tag.Key(nil), existing...)
+	for _, k := range keys {
+		found := false
+		for _, e := range result {
+			if e.Name() == k.Name() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+// SetMetricPrefix prefixes the names of the metrics of this package, so that the metrics of several services
+// can be told apart in Cloud Monitoring. For example, with the prefix "books/", the latency is recorded
+// as books/http_outbound_latency. Other functions of this package, such as SetDistributionBuckets,
+// still take the metric names without the prefix.
+//
+// Call it when the program starts, before any calls are made: the data already recorded for the metrics is discarded.
+func SetMetricPrefix(p string) error {
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+
+	for name, old := range views {
+		v := *old
+		v.Name = p + name
+		if err := replaceView(name, &v); err != nil {
+			return err
+		}
+	}
+	prefix = p
+	return nil
+}
@@ -0,0 +1,38 @@
+package httpClient
+
+import "net/http"
+
+// Middleware wraps a http.RoundTripper with extra behavior, such as authentication,
+// logging or header injection. The returned RoundTripper should call next to send the request.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter to allow the use of ordinary functions as a http.RoundTripper.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Use adds middleware around the instrumented transport for all calls made with the client.
+// The first middleware added is the outermost, so it sees the request first and the response last.
+// Use is not safe to call concurrently with Do; add middleware when setting up the client.
+func (c *Client) Use(mw ...Middleware) {
+	c.cfg.middleware = append(c.cfg.middleware, mw...)
+}
+
+// WithMiddleware adds middleware around the instrumented transport.
+// Middleware passed to Client.Do runs inside the middleware of the client.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(cfg *config) {
+		cfg.middleware = append(cfg.middleware, mw...)
+	}
+}
+
+// chain wraps rt with the middleware, so that mw[0] is the outermost.
+func chain(rt http.RoundTripper, mw []Middleware) http.RoundTripper {
+	for i := len(mw) - 1; i >= 0; i-- {
+		rt = mw[i](rt)
+	}
+	return rt
+}
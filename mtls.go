@@ -0,0 +1,83 @@
+package httpClient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// WithClientCertificate presents the client certificate to the host, such as "api.partner.com", or to every host
+// if host is "", for APIs that require mutual TLS. Create the certificate from PEM data in memory with
+// tls.X509KeyPair, or use WithClientCertificateFiles. A certificate for the host of the request takes precedence
+// over one for every host.
+//
+// The requests to the host are sent by a transport of their own, a copy of http.DefaultTransport, in place of the
+// transport set with WithTransport. Pass the option to New: the connections are pooled across every client created
+// with the same Option value.
+func WithClientCertificate(host string, cert tls.Certificate) Option {
+	return withClientCertificateFunc(host, func(ctx context.Context) (*tls.Certificate, error) {
+		return &cert, nil
+	})
+}
+
+// withClientCertificateFunc presents the client certificate returned by get to the host, or to every host
+// if host is "". get is called for every TLS handshake.
+func withClientCertificateFunc(host string, get func(ctx context.Context) (*tls.Certificate, error)) Option {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{
+		GetClientCertificate: func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return get(info.Context())
+		},
+	}
+	c := &clientCert{host: host, transport: t}
+	return func(cfg *config) {
+		cfg.clientCerts = append(cfg.clientCerts, c)
+	}
+}
+
+// WithClientCertificateFiles presents the client certificate in the PEM files to the host, or to every host
+// if host is "", like WithClientCertificate. If the files can't be loaded, Client.Do returns the error.
+func WithClientCertificateFiles(host string, certFile string, keyFile string) Option {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return func(cfg *config) {
+			cfg.err = fmt.Errorf("httpClient: loading client certificate: %w", err)
+		}
+	}
+	return WithClientCertificate(host, cert)
+}
+
+// clientCert is a transport presenting a client certificate to a host, or to every host if host is ""
+type clientCert struct {
+	host      string
+	transport *http.Transport
+}
+
+// certTransport sends the requests with the transport of the client certificate for their host,
+// if there is one, or with base
+type certTransport struct {
+	certs []*clientCert
+	base  http.RoundTripper
+}
+
+func (t *certTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var fallback *clientCert
+	for _, c := range t.certs {
+		switch {
+		case strings.EqualFold(c.host, req.URL.Hostname()):
+			return c.transport.RoundTrip(req)
+		case c.host == "" && fallback == nil:
+			fallback = c
+		}
+	}
+	if fallback != nil {
+		return fallback.transport.RoundTrip(req)
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
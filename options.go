@@ -0,0 +1,283 @@
+package httpClient
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/stackdriver/propagation"
+	"go.opencensus.io/tag"
+	ocpropagation "go.opencensus.io/trace/propagation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// DefaultTimeout is the timeout used by a Client when no timeout is supplied with WithTimeout.
+const DefaultTimeout = 30 * time.Second
+
+// Option configures a Client. Options can be passed to New, where they become the
+// defaults for every call made with the client, or to Client.Do, where they apply
+// to that call only and override the client defaults. For example, to use a shorter timeout
+// and an extra tag, registered with RegisterTagKeys, for one call:
+//
+//	tenantKey := tag.MustNewKey("tenant")
+//	httpClient.RegisterTagKeys(tenantKey)
+//	...
+//	client.Do(req, httpClient.WithTimeout(2*time.Second), httpClient.WithExtraTag(tenantKey, tenantID))
+type Option func(*config)
+
+// config holds the settings that can be changed with an Option.
+type config struct {
+	// How the HTTP call is made
+	timeout     time.Duration
+	transport   http.RoundTripper
+	doer        Doer
+	propagation ocpropagation.HTTPFormat
+	middleware  []Middleware
+	baseURL     *url.URL
+	endpoints   []*endpoint
+	outliers    *outlierDetector
+	shadow      *shadow
+	header      http.Header
+	spanName    SpanNameFormatter
+	baggage     []baggage.Member
+	tagBaggage  []tag.Key
+
+	// requestIDHeader is the header of the request ID; see WithRequestID
+	requestIDHeader string
+
+	// deadlineTimeout makes the timeout follow the context deadline; see WithDeadlineTimeout
+	deadlineTimeout bool
+	deadlineBuffer  time.Duration
+
+	// Metrics
+	apiName     string
+	versionName string
+	tags        []tag.Mutator
+	noMetrics   bool
+	success     SuccessPredicate
+	guards      []*cardinalityGuard
+
+	// versionSet tells that versionName was set with WithVersion, rather than to be detected
+	versionSet bool
+
+	// serverTiming records the Server-Timing entries of the responses; see WithServerTimingMetrics
+	serverTiming bool
+
+	// profilerLabels labels the goroutines of the calls; see WithProfilerLabels
+	profilerLabels bool
+
+	// OpenTelemetry; see WithTelemetry
+	telemetry      Telemetry
+	meterProvider  metric.MeterProvider
+	tracerProvider trace.TracerProvider
+	attributes     []attribute.KeyValue
+
+	statsd *StatsD
+	async  *asyncRecorder
+
+	// Resilience
+	retry          RetryPolicy
+	idempotencyKey bool
+	hedgeDelay     time.Duration
+	breakers       *keyed[*breaker]
+	bulkheads      *keyed[*bulkhead]
+	rateLimiters   *keyed[*rate.Limiter]
+	throttles      *keyed[*throttle]
+	concurrency    *keyed[*adaptiveLimiter]
+	shedder        *shedder
+	priority       Priority
+	dedup          *flightGroup
+	inFlight       *inFlightLimit
+	latencies      *keyed[*latencyTracker]
+
+	// Authentication
+	credentials CredentialProvider
+	apiKey      *APIKey
+	clientCerts []*clientCert
+
+	logger     *slog.Logger
+	requestLog *RequestLogConfig
+	curl       bool
+	har        *HARRecorder
+	archive    *Archiver
+	redactor   *Redactor
+
+	// errorReporter reports the repeated failures of the calls; see WithErrorReporting
+	errorReporter *ErrorReporter
+
+	// deadLetter publishes the calls that failed after their retries; see WithDeadLetter
+	deadLetter *DeadLetterPublisher
+
+	// cache serves the responses of the calls it holds; see WithHTTPCache
+	cache *Cache
+
+	// errorBody is the size of the snippet of error responses kept; see WithErrorBody
+	errorBody int
+
+	// slowThreshold is the latency above which attempts are logged; see WithSlowRequestLogging
+	slowThreshold time.Duration
+
+	// err holds an invalid option value; it is returned by Client.Do
+	err error
+}
+
+// defaultConfig returns the settings used when no options are given.
+func defaultConfig() config {
+	return config{
+		timeout:     DefaultTimeout,
+		propagation: &propagation.HTTPFormat{},
+	}
+}
+
+// apply returns a copy of cfg with the options applied. The original is not modified.
+func (cfg config) apply(opts []Option) config {
+	// Make sure appending to the slices of the copy never writes into the original slices
+	cfg.tags = cfg.tags[:len(cfg.tags):len(cfg.tags)]
+	cfg.middleware = cfg.middleware[:len(cfg.middleware):len(cfg.middleware)]
+	cfg.attributes = cfg.attributes[:len(cfg.attributes):len(cfg.attributes)]
+	cfg.guards = cfg.guards[:len(cfg.guards):len(cfg.guards)]
+	cfg.baggage = cfg.baggage[:len(cfg.baggage):len(cfg.baggage)]
+	cfg.tagBaggage = cfg.tagBaggage[:len(cfg.tagBaggage):len(cfg.tagBaggage)]
+	cfg.clientCerts = cfg.clientCerts[:len(cfg.clientCerts):len(cfg.clientCerts)]
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithTimeout sets the timeout for the HTTP call, including reading the response body.
+// If you don't need a timeout (not recommended), set a very long duration.
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = d
+	}
+}
+
+// WithDeadlineTimeout derives the timeout of the call from the deadline of the request context:
+// the timeout is the time remaining until the deadline minus the buffer, which leaves the
+// caller time to handle a timeout before its own deadline passes.
+// If the context has no deadline, the timeout set with WithTimeout (or DefaultTimeout) is used.
+// If less than the buffer remains, the call is not made and an error wrapping
+// context.DeadlineExceeded is returned.
+func WithDeadlineTimeout(buffer time.Duration) Option {
+	return func(cfg *config) {
+		cfg.deadlineTimeout = true
+		cfg.deadlineBuffer = buffer
+	}
+}
+
+// WithTransport sets the http.RoundTripper used to make the HTTP call.
+// The transport is wrapped with the OpenCensus transport, so trace propagation keeps working.
+// If not set, http.DefaultTransport is used; see WithTransportConfig to size its connection pool.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(cfg *config) {
+		cfg.transport = rt
+	}
+}
+
+// WithDoer replaces the HTTP call with the Doer. Metrics are recorded as usual.
+// The timeout, transport and propagation options have no effect when a Doer is set;
+// the Doer is responsible for them. This is mostly useful for stubbing the HTTP call in tests.
+func WithDoer(d Doer) Option {
+	return func(cfg *config) {
+		cfg.doer = d
+	}
+}
+
+// WithPropagation sets the format used to propagate the trace context on the outbound request.
+// The default is the Google Cloud Platform X-Cloud-Trace-Context header.
+func WithPropagation(format ocpropagation.HTTPFormat) Option {
+	return func(cfg *config) {
+		cfg.propagation = format
+	}
+}
+
+// WithAPIName sets the value of the APINameTag recorded with the metrics.
+// Should be a human-friendly name, such as /v1/books/search
+func WithAPIName(name string) Option {
+	return func(cfg *config) {
+		cfg.apiName = name
+	}
+}
+
+// WithVersion sets the value of the VersionTag recorded with the metrics.
+// It defaults to the Cloud Run revision or Compute Engine instance template, detected on the first call made
+// without WithVersion; see DetectedVersion.
+func WithVersion(name string) Option {
+	return func(cfg *config) {
+		cfg.versionName = name
+		cfg.versionSet = true
+	}
+}
+
+// WithTags adds tags to the recorded metrics, in addition to the tags defined by this package.
+// Tags with keys that are not part of the registered views are ignored by OpenCensus;
+// use RegisterTagKeys to add the keys to the views.
+func WithTags(mutators ...tag.Mutator) Option {
+	return func(cfg *config) {
+		cfg.tags = append(cfg.tags, mutators...)
+	}
+}
+
+// WithBaseURL sets the URL that relative request URLs are resolved against.
+// The path of the base URL is kept as a prefix of the request path.
+// If the URL can't be parsed, Client.Do returns the error.
+func WithBaseURL(rawURL string) Option {
+	return func(cfg *config) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			cfg.err = fmt.Errorf("httpClient: invalid base URL: %w", err)
+			return
+		}
+		cfg.baseURL = u
+	}
+}
+
+// WithExtraTag adds a tag to the recorded metrics; it is a shorthand for WithTags(tag.Upsert(key, value)).
+// The tag is ignored by OpenCensus unless the key is part of the registered views; see RegisterTagKeys.
+func WithExtraTag(key tag.Key, value string) Option {
+	return WithTags(tag.Upsert(key, value))
+}
+
+// WithHeader sets a header on the outbound request, replacing any value already on the request.
+func WithHeader(name string, value string) Option {
+	return func(cfg *config) {
+		// Clone so that a per-call header never leaks into the client defaults
+		h := cfg.header.Clone()
+		if h == nil {
+			h = http.Header{}
+		}
+		h.Set(name, value)
+		cfg.header = h
+	}
+}
+
+// WithoutMetrics turns off recording of metrics. This is mostly useful per call,
+// for example for health checks that would otherwise skew the latency metrics.
+// Programs that never record metrics can use the lite package instead, which doesn't depend on OpenCensus.
+func WithoutMetrics() Option {
+	return func(cfg *config) {
+		cfg.noMetrics = true
+	}
+}
+
+// WithLogger sets the logger for events such as endpoint ejections. Defaults to slog.Default().
+func WithLogger(l *slog.Logger) Option {
+	return func(cfg *config) {
+		cfg.logger = l
+	}
+}
+
+// log returns the logger to use.
+func (cfg *config) log() *slog.Logger {
+	if cfg.logger != nil {
+		return cfg.logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,218 @@
+package httpClient
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Telemetry selects the instrumentation used to record the metrics and traces of the calls.
+type Telemetry int
+
+const (
+	// OpenCensus records metrics and traces with OpenCensus. This is the default.
+	OpenCensus Telemetry = iota
+
+	// OpenTelemetry records metrics and traces with OpenTelemetry, using the names and attributes
+	// of the OpenTelemetry semantic conventions for HTTP clients, such as http.client.request.duration.
+	// The trace context is propagated with the global propagator; see otel.SetTextMapPropagator.
+	OpenTelemetry
+
+	// OpenCensusAndOpenTelemetry records with both, so that dashboards can be moved to the
+	// OpenTelemetry metrics one at a time. The trace context is propagated in the formats of both.
+	OpenCensusAndOpenTelemetry
+)
+
+// meterName is the name of the OpenTelemetry meter and tracer of this package
+const meterName = "github.com/ezachrisen/httpClient"
+
+// Attribute keys recorded with the OpenTelemetry metrics, in addition to the semantic convention attributes.
+// They hold the same values as the OpenCensus tags of the same name.
+const (
+	APINameAttribute  = attribute.Key("api_name")
+	VersionAttribute  = attribute.Key("version_name")
+	EndpointAttribute = attribute.Key("endpoint")
+	OutcomeAttribute  = attribute.Key("outcome")
+	AttemptAttribute  = attribute.Key("attempt")
+)
+
+// WithTelemetry selects the instrumentation used to record metrics and traces. The default is OpenCensus.
+//
+// With OpenTelemetry, the duration and the request and response body sizes of the calls are recorded as
+// http.client.request.duration, http.client.request.body.size and http.client.response.body.size, and the
+// HTTP calls are traced with otelhttp. The other metrics of this package, such as those of the circuit breaker,
+// are only recorded with OpenCensus. Tags added with WithTags are OpenCensus only; use WithAttributes instead.
+func WithTelemetry(t Telemetry) Option {
+	return func(cfg *config) {
+		cfg.telemetry = t
+	}
+}
+
+// WithMeterProvider sets the OpenTelemetry meter provider. Defaults to the global meter provider.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(cfg *config) {
+		cfg.meterProvider = mp
+	}
+}
+
+// WithTracerProvider sets the OpenTelemetry tracer provider. Defaults to the global tracer provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(cfg *config) {
+		cfg.tracerProvider = tp
+	}
+}
+
+// WithAttributes adds attributes to the OpenTelemetry metrics, in addition to the attributes defined by this package.
+func WithAttributes(attrs ...attribute.KeyValue) Option {
+	return func(cfg *config) {
+		cfg.attributes = append(cfg.attributes, attrs...)
+	}
+}
+
+// openCensus reports whether metrics and traces are recorded with OpenCensus.
+func (cfg *config) openCensus() bool {
+	return cfg.telemetry != OpenTelemetry
+}
+
+// openTelemetry reports whether metrics and traces are recorded with OpenTelemetry.
+func (cfg *config) openTelemetry() bool {
+	return cfg.telemetry != OpenCensus
+}
+
+// meters returns the meter provider to use.
+func (cfg *config) meters() metric.MeterProvider {
+	if cfg.meterProvider != nil {
+		return cfg.meterProvider
+	}
+	return otel.GetMeterProvider()
+}
+
+// otelTransport returns rt wrapped in the otelhttp transport.
+func (cfg *config) otelTransport(rt http.RoundTripper) http.RoundTripper {
+	var opts []otelhttp.Option
+	if cfg.tracerProvider != nil {
+		opts = append(opts, otelhttp.WithTracerProvider(cfg.tracerProvider))
+	}
+	if cfg.spanName != nil {
+		opts = append(opts, otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			return cfg.spanName(req, cfg.apiName)
+		}))
+	}
+	// The metrics are recorded by this package, with the API name
+	opts = append(opts, otelhttp.WithMeterProvider(noop.NewMeterProvider()))
+	return otelhttp.NewTransport(rt, opts...)
+}
+
+// otelInstruments are the OpenTelemetry instruments of a meter provider.
+type otelInstruments struct {
+	duration     metric.Float64Histogram
+	requestSize  metric.Int64Histogram
+	responseSize metric.Int64Histogram
+}
+
+var (
+	instrumentsMu sync.Mutex
+
+	// instruments holds the instruments by meter provider, since creating them for every call would be wasteful
+	instruments = map[metric.MeterProvider]*otelInstruments{}
+)
+
+// durationBuckets are the bucket boundaries, in seconds, advised by the semantic conventions for http.client.request.duration.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// instrumentsFor returns the instruments of the meter provider, creating them the first time.
+func instrumentsFor(mp metric.MeterProvider) (*otelInstruments, error) {
+	instrumentsMu.Lock()
+	defer instrumentsMu.Unlock()
+	if in, ok := instruments[mp]; ok {
+		return in, nil
+	}
+
+	meter := mp.Meter(meterName)
+	var in otelInstruments
+	var err error
+	in.duration, err = meter.Float64Histogram("http.client.request.duration",
+		metric.WithDescription("Duration of HTTP client requests."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+	in.requestSize, err = meter.Int64Histogram("http.client.request.body.size",
+		metric.WithDescription("Size of HTTP client request bodies."),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	in.responseSize, err = meter.Int64Histogram("http.client.response.body.size",
+		metric.WithDescription("Size of HTTP client response bodies."),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	instruments[mp] = &in
+	return &in, nil
+}
+
+// otelAttributes returns the attributes recorded with the OpenTelemetry metrics of a call.
+func (cl *call) otelAttributes(req *http.Request, ep *endpoint, resp *http.Response, err error) []attribute.KeyValue {
+	cfg := cl.cfg
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.ServerAddress(req.URL.Hostname()),
+		semconv.URLScheme(req.URL.Scheme),
+		APINameAttribute.String(cfg.apiName),
+		VersionAttribute.String(cfg.versionName),
+		OutcomeAttribute.String(cfg.outcome(resp, err)),
+		AttemptAttribute.Int(cl.attempt),
+	}
+	if port, perr := strconv.Atoi(req.URL.Port()); perr == nil {
+		attrs = append(attrs, semconv.ServerPort(port))
+	}
+	if resp != nil {
+		attrs = append(attrs, semconv.HTTPResponseStatusCode(resp.StatusCode), semconv.NetworkProtocolVersion(protocolVersion(resp)))
+		if resp.StatusCode >= 400 {
+			attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(resp.StatusCode)))
+		}
+	} else {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(classifyError(err)))
+	}
+	if ep != nil {
+		attrs = append(attrs, EndpointAttribute.String(ep.name))
+	}
+	return append(attrs, cfg.attributes...)
+}
+
+// recordOTel records the OpenTelemetry metrics of a call.
+func (cl *call) recordOTel(req *http.Request, ep *endpoint, resp *http.Response, err error, latency time.Duration, requestBytes int64) error {
+	in, ierr := instrumentsFor(cl.cfg.meters())
+	if ierr != nil {
+		return ierr
+	}
+	ctx := req.Context()
+	set := metric.WithAttributeSet(attribute.NewSet(cl.otelAttributes(req, ep, resp, err)...))
+	in.duration.Record(ctx, latency.Seconds(), set)
+	in.requestSize.Record(ctx, requestBytes, set)
+	countResponseBytes(resp, func(n int64, returned bool) {
+		in.responseSize.Record(ctx, n, set)
+	})
+	return nil
+}
+
+// protocolVersion returns the version of HTTP of the response in the format of the network.protocol.version
+// attribute: "1.1", "2" or "3".
+func protocolVersion(resp *http.Response) string {
+	if resp.ProtoMajor >= 2 {
+		return strconv.Itoa(resp.ProtoMajor)
+	}
+	return strconv.Itoa(resp.ProtoMajor) + "." + strconv.Itoa(resp.ProtoMinor)
+}
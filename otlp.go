@@ -0,0 +1,98 @@
+package httpClient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// OTLPConfig configures the export of metrics and traces to an OTLP collector; see StartOTLP.
+type OTLPConfig struct {
+	// Endpoint is the host and port of the collector's OTLP/HTTP receiver.
+	// Defaults to localhost:4318.
+	Endpoint string
+
+	// Headers are sent with every export, for example to authenticate with the collector.
+	Headers map[string]string
+
+	// Insecure sends the data over plain HTTP rather than HTTPS, for a collector running next to the service.
+	Insecure bool
+
+	// TLSConfig, if set, configures the HTTPS connection, for example with a client certificate.
+	TLSConfig *tls.Config
+
+	// ServiceName is the service.name of the exported data.
+	ServiceName string
+
+	// ExportInterval is how often the metrics are exported. Defaults to 60s.
+	ExportInterval time.Duration
+}
+
+// StartOTLP exports OpenTelemetry metrics and traces to an OTLP collector. It sets the global meter
+// provider, tracer provider and W3C Trace Context propagator, which clients using WithTelemetry(OpenTelemetry)
+// use unless other providers are set with WithMeterProvider and WithTracerProvider.
+//
+// Call the returned function when the program exits, to export the remaining data:
+//
+//	shutdown, err := httpClient.StartOTLP(ctx, httpClient.OTLPConfig{ServiceName: "books"})
+//	if err != nil {
+//		...
+//	}
+//	defer shutdown(context.Background())
+func StartOTLP(ctx context.Context, c OTLPConfig) (shutdown func(context.Context) error, err error) {
+	if c.Endpoint == "" {
+		c.Endpoint = "localhost:4318"
+	}
+	if c.ExportInterval <= 0 {
+		c.ExportInterval = 60 * time.Second
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(c.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: creating OTLP resource: %w", err)
+	}
+
+	traceOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(c.Endpoint), otlptracehttp.WithHeaders(c.Headers)}
+	metricOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(c.Endpoint), otlpmetrichttp.WithHeaders(c.Headers)}
+	if c.Insecure {
+		traceOpts = append(traceOpts, otlptracehttp.WithInsecure())
+		metricOpts = append(metricOpts, otlpmetrichttp.WithInsecure())
+	}
+	if c.TLSConfig != nil {
+		traceOpts = append(traceOpts, otlptracehttp.WithTLSClientConfig(c.TLSConfig))
+		metricOpts = append(metricOpts, otlpmetrichttp.WithTLSClientConfig(c.TLSConfig))
+	}
+
+	traceExporter, err := otlptracehttp.New(ctx, traceOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: creating OTLP trace exporter: %w", err)
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx, metricOpts...)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("httpClient: creating OTLP metric exporter: %w", err), traceExporter.Shutdown(ctx))
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(traceExporter), sdktrace.WithResource(res))
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(c.ExportInterval))),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		return errors.Join(tp.Shutdown(ctx), mp.Shutdown(ctx))
+	}, nil
+}
@@ -0,0 +1,47 @@
+package httpClient
+
+import (
+	"net/http"
+
+	"go.opencensus.io/tag"
+)
+
+// OutcomeTag is the outcome of the call, "success" or "failure", as decided by the SuccessPredicate.
+// Recorded with the latency and counter metrics.
+var OutcomeTag = tag.MustNewKey("outcome")
+
+// SuccessPredicate reports whether a call that returned resp and err succeeded, for the OutcomeTag.
+// resp is nil if err is not nil.
+type SuccessPredicate func(resp *http.Response, err error) bool
+
+// DefaultSuccessPredicate treats a call as successful if it returned a response with a status code below 400.
+func DefaultSuccessPredicate(resp *http.Response, err error) bool {
+	return err == nil && resp.StatusCode < 400
+}
+
+// WithSuccessPredicate sets the predicate that decides the value of the OutcomeTag, so that the
+// meaning of success for the API is recorded with the metrics rather than encoded in queries.
+// For example, for a lookup API where not finding the item is an expected result:
+//
+//	WithSuccessPredicate(func(resp *http.Response, err error) bool {
+//		return err == nil && (resp.StatusCode < 400 || resp.StatusCode == http.StatusNotFound)
+//	})
+//
+// If not set, DefaultSuccessPredicate is used.
+func WithSuccessPredicate(p SuccessPredicate) Option {
+	return func(cfg *config) {
+		cfg.success = p
+	}
+}
+
+// outcome returns the value of the OutcomeTag for a call that returned resp and err.
+func (cfg *config) outcome(resp *http.Response, err error) string {
+	success := DefaultSuccessPredicate
+	if cfg.success != nil {
+		success = cfg.success
+	}
+	if success(resp, err) {
+		return "success"
+	}
+	return "failure"
+}
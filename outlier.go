@@ -0,0 +1,169 @@
+package httpClient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definition for endpoint ejections by the outlier detector
+	endpointEjections = stats.Int64("http_outbound_endpoint_ejections", "Endpoints of the external HTTP API ejected for failing too often", stats.UnitDimensionless)
+)
+
+func init() {
+	registerCounterMetric(endpointEjections, []tag.Key{APINameTag, EndpointTag})
+}
+
+// OutlierConfig configures outlier detection for the endpoints set with WithEndpoints.
+type OutlierConfig struct {
+	// FailureRate is the share of failed calls (0 to 1) within Window that ejects an endpoint.
+	// A call failed if it returned an error or a 5xx status. Defaults to 0.5.
+	FailureRate float64
+
+	// MinRequests is the number of calls an endpoint must get within Window before it can be ejected.
+	// Defaults to 10.
+	MinRequests int
+
+	// Window is the period over which the failure rate is calculated. Defaults to 30 seconds.
+	Window time.Duration
+
+	// EjectionTime is how long an endpoint stays ejected. Defaults to 30 seconds.
+	EjectionTime time.Duration
+}
+
+func (c OutlierConfig) withDefaults() OutlierConfig {
+	if c.FailureRate <= 0 {
+		c.FailureRate = 0.5
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 10
+	}
+	if c.Window <= 0 {
+		c.Window = 30 * time.Second
+	}
+	if c.EjectionTime <= 0 {
+		c.EjectionTime = 30 * time.Second
+	}
+	return c
+}
+
+// WithOutlierDetection tracks the failure rate of each endpoint set with WithEndpoints, and
+// temporarily ejects endpoints that fail too often: ejected endpoints are skipped until the
+// ejection time has passed. The last endpoint that is not ejected is never ejected, and if all
+// endpoints are ejected they are all used.
+// Pass the option to New: endpoint health is shared by every client created with the same Option value.
+// Ejections are logged as warnings and counted in the http_outbound_endpoint_ejections metric.
+func WithOutlierDetection(c OutlierConfig) Option {
+	d := &outlierDetector{cfg: c.withDefaults(), health: map[*endpoint]*endpointHealth{}}
+	return func(cfg *config) {
+		cfg.outliers = d
+	}
+}
+
+// outlierDetector tracks the health of endpoints
+type outlierDetector struct {
+	cfg OutlierConfig
+
+	mu     sync.Mutex
+	health map[*endpoint]*endpointHealth
+}
+
+// endpointHealth is the failure count of an endpoint in the current window
+type endpointHealth struct {
+	windowStart  time.Time
+	requests     int
+	failures     int
+	ejectedUntil time.Time
+}
+
+// get returns the health of the endpoint. The caller must hold d.mu.
+func (d *outlierDetector) get(ep *endpoint) *endpointHealth {
+	h, ok := d.health[ep]
+	if !ok {
+		h = &endpointHealth{windowStart: time.Now()}
+		d.health[ep] = h
+	}
+	return h
+}
+
+// available returns the endpoints that are not ejected, in order, or all of them if they are all ejected.
+func (d *outlierDetector) available(endpoints []*endpoint) []*endpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	var ok []*endpoint
+	for _, ep := range endpoints {
+		if !now.Before(d.get(ep).ejectedUntil) {
+			ok = append(ok, ep)
+		}
+	}
+	if len(ok) == 0 {
+		return endpoints
+	}
+	return ok
+}
+
+// record counts a call to the endpoint, and returns true if the endpoint is ejected because of it.
+// endpoints are all the endpoints of the API, used to keep at least one of them in use.
+func (d *outlierDetector) record(ep *endpoint, endpoints []*endpoint, failed bool) (ejected bool, rate float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	h := d.get(ep)
+	if now.Before(h.ejectedUntil) {
+		return false, 0
+	}
+	if now.Sub(h.windowStart) > d.cfg.Window {
+		h.windowStart, h.requests, h.failures = now, 0, 0
+	}
+	h.requests++
+	if failed {
+		h.failures++
+	}
+	rate = float64(h.failures) / float64(h.requests)
+	if h.requests < d.cfg.MinRequests || rate < d.cfg.FailureRate {
+		return false, rate
+	}
+
+	healthy := 0
+	for _, other := range endpoints {
+		if !now.Before(d.get(other).ejectedUntil) {
+			healthy++
+		}
+	}
+	if healthy <= 1 {
+		return false, rate
+	}
+	h.ejectedUntil = now.Add(d.cfg.EjectionTime)
+	h.windowStart, h.requests, h.failures = h.ejectedUntil, 0, 0
+	return true, rate
+}
+
+// recordOutlier counts the outcome of a call to the endpoint, ejecting the endpoint if it fails too often.
+func (cl *call) recordOutlier(ctx context.Context, ep *endpoint, failed bool) {
+	if cl.cfg.outliers == nil || ep == nil {
+		return
+	}
+	ejected, rate := cl.cfg.outliers.record(ep, cl.cfg.endpoints, failed)
+	if !ejected {
+		return
+	}
+	cl.cfg.log().Warn("httpClient: endpoint ejected",
+		"api", cl.cfg.apiName,
+		"endpoint", ep.name,
+		"failure_rate", rate,
+		"ejection_time", cl.cfg.outliers.cfg.EjectionTime)
+	if !cl.cfg.noMetrics {
+		cl.metricError(stats.RecordWithTags(ctx,
+			[]tag.Mutator{
+				tag.Upsert(APINameTag, cl.cfg.apiName),
+				tag.Upsert(EndpointTag, ep.name),
+			},
+			endpointEjections.M(1)))
+	}
+}
@@ -0,0 +1,34 @@
+package httpClient
+
+import (
+	"net/http"
+	"runtime/pprof"
+)
+
+// Profiler labels set by WithProfilerLabels
+const (
+	APINameLabel    = "api_name"
+	HTTPMethodLabel = "http_method"
+)
+
+// WithProfilerLabels labels the goroutine making the call, and the goroutines it starts, such as hedged
+// attempts, with the APINameLabel and HTTPMethodLabel profiler labels for the duration of the call, like
+// pprof.Do, so that the CPU profiles of Cloud Profiler can be sliced by the API the time was spent calling.
+// The labels already set on the context of the request are kept.
+func WithProfilerLabels() Option {
+	return func(cfg *config) {
+		cfg.profilerLabels = true
+	}
+}
+
+// withProfilerLabels sets the profiler labels of the call on the goroutine and the request.
+// Call restore when the call is done, to set the labels of the goroutine back.
+func (cfg *config) withProfilerLabels(req *http.Request) (r *http.Request, restore func()) {
+	if !cfg.profilerLabels {
+		return req, func() {}
+	}
+	parent := req.Context()
+	ctx := pprof.WithLabels(parent, pprof.Labels(APINameLabel, cfg.apiName, HTTPMethodLabel, req.Method))
+	pprof.SetGoroutineLabels(ctx)
+	return req.WithContext(ctx), func() { pprof.SetGoroutineLabels(parent) }
+}
@@ -0,0 +1,29 @@
+package httpClient
+
+import (
+	"log/slog"
+	"net/http"
+
+	"contrib.go.opencensus.io/exporter/prometheus"
+)
+
+// NewPrometheusHandler returns an http.Handler that serves the metrics of this package, and any other
+// registered OpenCensus views, in the Prometheus format, for services that are scraped by Prometheus
+// rather than exporting to Cloud Monitoring. Serve it on the path Prometheus scrapes:
+//
+//	h, err := httpClient.NewPrometheusHandler("myservice")
+//	if err != nil {
+//		...
+//	}
+//	http.Handle("/metrics", h)
+//
+// The namespace, if not empty, is prefixed to the metric names, as in myservice_http_outbound_latency.
+// Errors collecting the metrics are logged with slog.Default().
+func NewPrometheusHandler(namespace string) (http.Handler, error) {
+	return prometheus.NewExporter(prometheus.Options{
+		Namespace: namespace,
+		OnError: func(err error) {
+			slog.Default().Error("httpClient: exporting metrics to Prometheus", "error", err)
+		},
+	})
+}
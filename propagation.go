@@ -0,0 +1,36 @@
+package httpClient
+
+import (
+	"net/http"
+
+	"go.opencensus.io/trace"
+	ocpropagation "go.opencensus.io/trace/propagation"
+)
+
+// CompositeFormat propagates the trace context in several formats at once, for clients that call
+// a mix of services that understand different formats. Use it with WithPropagation, for example
+// for Google Cloud, W3C Trace Context and B3:
+//
+//	httpClient.WithPropagation(httpClient.CompositeFormat{
+//		&propagation.HTTPFormat{},  // contrib.go.opencensus.io/exporter/stackdriver/propagation
+//		&tracecontext.HTTPFormat{}, // go.opencensus.io/plugin/ochttp/propagation/tracecontext
+//		&httpClient.B3Format{},
+//	})
+type CompositeFormat []ocpropagation.HTTPFormat
+
+// SpanContextFromRequest returns the trace context read by the first format that finds one in the request.
+func (c CompositeFormat) SpanContextFromRequest(req *http.Request) (trace.SpanContext, bool) {
+	for _, f := range c {
+		if sc, ok := f.SpanContextFromRequest(req); ok {
+			return sc, true
+		}
+	}
+	return trace.SpanContext{}, false
+}
+
+// SpanContextToRequest writes the trace context to the request in every format.
+func (c CompositeFormat) SpanContextToRequest(sc trace.SpanContext, req *http.Request) {
+	for _, f := range c {
+		f.SpanContextToRequest(sc, req)
+	}
+}
@@ -0,0 +1,51 @@
+package httpClient
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// OpenCensus metric definition for the time spent waiting on the rate limiter
+	rateLimitWait = stats.Int64("http_outbound_ratelimit_wait", "Time spent waiting on the rate limiter before calling the external HTTP API", stats.UnitMilliseconds)
+)
+
+func init() {
+	registerLatencyMetric(rateLimitWait, []tag.Key{APINameTag})
+}
+
+// WithRateLimit limits the calls to each API to requestsPerSecond, allowing bursts of up to burst calls,
+// using a token bucket. Calls wait for their turn, or until their context is done; a call that
+// can't get a turn before its context deadline fails right away. Every retry counts as a call.
+// Rate limiters are kept per API name. Pass the option to New: the limiters are shared by every
+// client created with the same Option value.
+// The time spent waiting is recorded in the http_outbound_ratelimit_wait metric.
+func WithRateLimit(requestsPerSecond float64, burst int) Option {
+	limiters := newKeyed(func(string) *rate.Limiter {
+		return rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
+	})
+	return func(cfg *config) {
+		cfg.rateLimiters = limiters
+	}
+}
+
+// waitRateLimit waits until the rate limiter of the API lets the call through, and records the time spent waiting.
+func (cl *call) waitRateLimit(ctx context.Context) error {
+	if cl.cfg.rateLimiters == nil {
+		return nil
+	}
+	start := time.Now()
+	if err := cl.cfg.rateLimiters.get(cl.cfg.apiName).Wait(ctx); err != nil {
+		return err
+	}
+	if !cl.cfg.noMetrics {
+		cl.metricError(stats.RecordWithTags(ctx,
+			[]tag.Mutator{tag.Upsert(APINameTag, cl.cfg.apiName)},
+			rateLimitWait.M(time.Since(start).Milliseconds())))
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package httpClient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Redactor masks sensitive data in the calls before they leave the process, in the logs of WithRequestLogging,
+// WithSlowRequestLogging and WithCurlLogging, and in the entries captured by a HARRecorder or an Archiver.
+// The redacted values are replaced with RedactedValue. The user info of URLs is always redacted.
+//
+// Set a Redactor with WithRedactor. The zero Redactor redacts nothing but the user info of URLs.
+type Redactor struct {
+	// AllowHeaders, if set, are the only headers whose values are kept; the values of every other header are redacted.
+	AllowHeaders []string
+
+	// DenyHeaders are headers whose values are redacted, such as DefaultRedactedHeaders.
+	DenyHeaders []string
+
+	// Query are the query parameters whose values are redacted, such as "key" or "token".
+	Query []string
+
+	// BodyFields are the fields of JSON bodies whose values are redacted, as paths of field names separated by
+	// dots, such as "user.email". The fields of the elements of arrays are reached through the array, so
+	// "items.card" redacts the card field of every element of items. "*" matches any field name.
+	// A JSON body that can't be parsed, such as one truncated by a HARRecorder, is redacted entirely.
+	BodyFields []string
+
+	// Patterns are scrubbed from the header values, URLs and bodies, such as card or social security numbers.
+	Patterns []*regexp.Regexp
+}
+
+// DefaultRedactor is the Redactor used when WithRedactor and WithRequestLogging are not set.
+var DefaultRedactor = &Redactor{DenyHeaders: DefaultRedactedHeaders}
+
+// WithRedactor masks sensitive data in the logs and captured calls with the redactor.
+// It takes precedence over RequestLogConfig.RedactHeaders and RequestLogConfig.RedactQuery.
+func WithRedactor(r *Redactor) Option {
+	return func(cfg *config) {
+		cfg.redactor = r
+	}
+}
+
+// redaction returns the redactor of the call: the one set with WithRedactor, or the one built from the
+// RequestLogConfig, or DefaultRedactor, also redacting the API key of WithAPIKey.
+func (cfg *config) redaction() *Redactor {
+	var r *Redactor
+	switch {
+	case cfg.redactor != nil:
+		r = cfg.redactor
+	case cfg.requestLog != nil:
+		r = &Redactor{DenyHeaders: cfg.requestLog.RedactHeaders, Query: cfg.requestLog.RedactQuery}
+	default:
+		r = DefaultRedactor
+	}
+	if k := cfg.apiKey; k != nil {
+		c := *r
+		if k.Header != "" {
+			c.DenyHeaders = append(c.DenyHeaders[:len(c.DenyHeaders):len(c.DenyHeaders)], k.Header)
+		} else {
+			c.Query = append(c.Query[:len(c.Query):len(c.Query)], k.Query)
+		}
+		r = &c
+	}
+	return r
+}
+
+// Headers returns a copy of the headers with the values of the redacted headers replaced,
+// and the patterns scrubbed from the others.
+func (r *Redactor) Headers(h http.Header) http.Header {
+	c := h.Clone()
+	for name, values := range c {
+		if r.deniedHeader(name) {
+			for i := range values {
+				values[i] = RedactedValue
+			}
+			continue
+		}
+		for i, v := range values {
+			values[i] = r.scrub(v)
+		}
+	}
+	return c
+}
+
+// deniedHeader reports whether the values of the header are redacted.
+func (r *Redactor) deniedHeader(name string) bool {
+	if r.AllowHeaders != nil && !containsFold(r.AllowHeaders, name) {
+		return true
+	}
+	return containsFold(r.DenyHeaders, name)
+}
+
+// URL returns the URL with the user info and the values of the redacted query parameters replaced,
+// and the patterns scrubbed.
+func (r *Redactor) URL(u *url.URL) string {
+	if len(r.Query) == 0 || u.RawQuery == "" {
+		return r.scrub(u.Redacted())
+	}
+	q := u.Query()
+	redacted := false
+	for _, p := range r.Query {
+		if values, ok := q[p]; ok {
+			for i := range values {
+				values[i] = RedactedValue
+			}
+			redacted = true
+		}
+	}
+	if !redacted {
+		return r.scrub(u.Redacted())
+	}
+	c := *u
+	c.RawQuery = q.Encode()
+	return r.scrub(c.Redacted())
+}
+
+// errorString returns the text of the error of a call to the URL, with the URL of the *url.Error of net/http,
+// which holds the query, redacted like the URL, and the patterns scrubbed.
+func (r *Redactor) errorString(u *url.URL, err error) string {
+	s := err.Error()
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		redacted := &url.Error{Op: ue.Op, URL: r.URL(u), Err: ue.Err}
+		s = strings.ReplaceAll(s, ue.Error(), redacted.Error())
+	}
+	return r.scrub(s)
+}
+
+// Body returns the body, of the given content type, with the redacted JSON fields replaced and the patterns scrubbed.
+func (r *Redactor) Body(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(r.BodyFields) > 0 && strings.Contains(contentType, "json") {
+		var v any
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			return RedactedValue
+		}
+		for _, f := range r.BodyFields {
+			v = redactJSON(v, strings.Split(f, "."))
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return RedactedValue
+		}
+		body = b
+	}
+	return r.scrub(string(body))
+}
+
+// scrub replaces the matches of the patterns in s.
+func (r *Redactor) scrub(s string) string {
+	for _, p := range r.Patterns {
+		s = p.ReplaceAllString(s, RedactedValue)
+	}
+	return s
+}
+
+// redactJSON returns the decoded JSON value v with the value at the path replaced.
+func redactJSON(v any, path []string) any {
+	if len(path) == 0 {
+		return RedactedValue
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for k, fv := range v {
+			if path[0] == "*" || path[0] == k {
+				v[k] = redactJSON(fv, path[1:])
+			}
+		}
+	case []any:
+		if i, err := strconv.Atoi(path[0]); err == nil {
+			if i >= 0 && i < len(v) {
+				v[i] = redactJSON(v[i], path[1:])
+			}
+			return v
+		}
+		for i := range v {
+			v[i] = redactJSON(v[i], path)
+		}
+	}
+	return v
+}
+
+// containsFold reports whether the header names contain name, ignoring case.
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package httpClient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisCachePrefix is the prefix of the keys of a RedisCacheStore when none is given.
+const DefaultRedisCachePrefix = "httpClient:cache:"
+
+// RedisCacheStore is a CacheStore in Redis, such as a Memorystore for Redis instance, so that the instances of a
+// Cloud Run service share one cache of the responses of an API:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "10.0.0.3:6379"})
+//	cache := httpClient.NewCache(httpClient.CacheConfig{Store: httpClient.NewRedisCacheStore(rdb, "")})
+//	client := httpClient.New(httpClient.WithAPIName("catalog"), httpClient.WithHTTPCache(cache))
+//
+// The responses that can be revalidated are stored without an expiry, so set the maxmemory-policy of the
+// instance to allkeys-lru to evict the least recently used responses when it's full.
+//
+// Use a different prefix per Cache when the caches of several APIs share an instance, so that their invalidations
+// don't scan each other's keys. A RedisCacheStore is safe for concurrent use by multiple goroutines.
+type RedisCacheStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisCacheStore returns a RedisCacheStore that stores the responses with the client, under keys that start
+// with the prefix, or DefaultRedisCachePrefix if it's "". The client may be a cluster client.
+func NewRedisCacheStore(client redis.UniversalClient, prefix string) *RedisCacheStore {
+	if prefix == "" {
+		prefix = DefaultRedisCachePrefix
+	}
+	return &RedisCacheStore{client: client, prefix: prefix}
+}
+
+// Get implements CacheStore.
+func (s *RedisCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Set implements CacheStore.
+func (s *RedisCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+// Delete implements CacheStore.
+func (s *RedisCacheStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+// DeleteMatching implements CacheStore. It scans the keys with the prefix, on every master of a cluster.
+func (s *RedisCacheStore) DeleteMatching(ctx context.Context, match func(key string) bool) error {
+	if cluster, ok := s.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return s.deleteMatching(ctx, node, match)
+		})
+	}
+	return s.deleteMatching(ctx, s.client, match)
+}
+
+// deleteMatching deletes the matching keys of one Redis server, a batch of scanned keys at a time.
+func (s *RedisCacheStore) deleteMatching(ctx context.Context, c redis.Cmdable, match func(key string) bool) error {
+	pattern := redisGlobEscaper.Replace(s.prefix) + "*"
+	var cursor uint64
+	for {
+		keys, next, err := c.Scan(ctx, cursor, pattern, 1000).Result()
+		if err != nil {
+			return err
+		}
+		var matched []string
+		for _, k := range keys {
+			if match(strings.TrimPrefix(k, s.prefix)) {
+				matched = append(matched, k)
+			}
+		}
+		if len(matched) > 0 {
+			// One DEL per key, as the keys of a cluster node are in different hash slots
+			_, err := c.Pipelined(ctx, func(p redis.Pipeliner) error {
+				for _, k := range matched {
+					p.Del(ctx, k)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// redisGlobEscaper escapes the special characters of the patterns of SCAN MATCH
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
@@ -0,0 +1,76 @@
+package httpClient
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry holds named Clients, one per API, so that the configuration of each API
+// (base URL, timeout, tags) is declared in one place and the APINameTag is always the same.
+// A Registry is safe for concurrent use by multiple goroutines.
+type Registry struct {
+	mu      sync.RWMutex
+	clients map[string]*Client
+}
+
+// DefaultRegistry is the Registry used by Register and For.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{clients: map[string]*Client{}}
+}
+
+// Register creates a Client for the named API and stores it in the registry, replacing any
+// Client previously registered under the name. The name is used as the APINameTag.
+func (r *Registry) Register(name string, opts ...Option) *Client {
+	c := New(append([]Option{WithAPIName(name)}, opts...)...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[name] = c
+	return c
+}
+
+// Lookup returns the Client registered under the name, and whether it was found.
+func (r *Registry) Lookup(name string) (*Client, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.clients[name]
+	return c, ok
+}
+
+// For returns the Client registered under the name.
+// For panics if no Client is registered under the name; APIs are expected to be
+// registered when the program starts, so a missing name is a programming error.
+func (r *Registry) For(name string) *Client {
+	c, ok := r.Lookup(name)
+	if !ok {
+		panic(fmt.Sprintf("httpClient: no API registered with name %q", name))
+	}
+	return c
+}
+
+// Names returns the names of the registered APIs in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.clients))
+	for name := range r.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Register creates a Client for the named API in the DefaultRegistry.
+func Register(name string, opts ...Option) *Client {
+	return DefaultRegistry.Register(name, opts...)
+}
+
+// For returns the Client registered under the name in the DefaultRegistry.
+// For panics if no Client is registered under the name.
+func For(name string) *Client {
+	return DefaultRegistry.For(name)
+}
@@ -0,0 +1,131 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+// RequestBuilder builds an *http.Request from a URL template such as /v1/books/{id}.
+// Path parameters are escaped, query parameters are encoded and headers are set.
+// Create a RequestBuilder with Client.NewRequest. The methods return the builder,
+// so calls can be chained:
+//
+//	req, err := client.NewRequest("GET", "/v1/books/{id}").Param("id", id).Query("q", term).Build()
+type RequestBuilder struct {
+	client   *Client
+	method   string
+	template string
+	ctx      context.Context
+	params   map[string]string
+	query    url.Values
+	header   http.Header
+	body     io.Reader
+}
+
+// pathParam matches a {name} placeholder in a URL template
+var pathParam = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// NewRequest returns a RequestBuilder for the method and URL template.
+// A relative URL is resolved against the base URL of the client.
+func (c *Client) NewRequest(method string, urlTemplate string) *RequestBuilder {
+	return &RequestBuilder{
+		client:   c,
+		method:   method,
+		template: urlTemplate,
+		ctx:      context.Background(),
+		params:   map[string]string{},
+		query:    url.Values{},
+		header:   http.Header{},
+	}
+}
+
+// Context sets the context of the request.
+func (b *RequestBuilder) Context(ctx context.Context) *RequestBuilder {
+	b.ctx = ctx
+	return b
+}
+
+// Param sets the value of the {name} placeholder in the URL template.
+// The value is path-escaped, so it can safely contain slashes and other reserved characters.
+func (b *RequestBuilder) Param(name string, value string) *RequestBuilder {
+	b.params[name] = value
+	return b
+}
+
+// Query adds a query parameter. Calling Query more than once with the same name adds multiple values.
+func (b *RequestBuilder) Query(name string, value string) *RequestBuilder {
+	b.query.Add(name, value)
+	return b
+}
+
+// Header sets a request header, replacing any existing values.
+func (b *RequestBuilder) Header(name string, value string) *RequestBuilder {
+	b.header.Set(name, value)
+	return b
+}
+
+// Body sets the request body.
+func (b *RequestBuilder) Body(body io.Reader) *RequestBuilder {
+	b.body = body
+	return b
+}
+
+// Build returns the request. It fails if a placeholder in the URL template has no value,
+// if a value was set for a placeholder that is not in the template, or if the resulting URL is invalid.
+func (b *RequestBuilder) Build() (*http.Request, error) {
+	used := map[string]bool{}
+	var missing []string
+	path := pathParam.ReplaceAllStringFunc(b.template, func(m string) string {
+		name := m[1 : len(m)-1]
+		v, ok := b.params[name]
+		if !ok {
+			missing = append(missing, name)
+			return m
+		}
+		used[name] = true
+		return url.PathEscape(v)
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("httpClient: no value for path parameters %v in %q", missing, b.template)
+	}
+	for name := range b.params {
+		if !used[name] {
+			return nil, fmt.Errorf("httpClient: path parameter %q not found in %q", name, b.template)
+		}
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: invalid URL: %w", err)
+	}
+	if len(b.query) > 0 {
+		q := u.Query()
+		for name, values := range b.query {
+			q[name] = append(q[name], values...)
+		}
+		u.RawQuery = q.Encode()
+	}
+	u = resolveURL(b.client.cfg.baseURL, u)
+
+	req, err := http.NewRequestWithContext(withURLTemplate(b.ctx, b.template), b.method, u.String(), b.body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range b.header {
+		req.Header[name] = values
+	}
+	return req, nil
+}
+
+// Do builds the request and sends it with the client.
+func (b *RequestBuilder) Do(opts ...Option) (*http.Response, error) {
+	req, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return b.client.Do(req, opts...)
+}
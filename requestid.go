@@ -0,0 +1,57 @@
+package httpClient
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultRequestIDHeader is the header that carries the request ID when WithRequestID is given no header.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a context carrying the request ID, such as the ID of the incoming request
+// being served, to be sent with the calls made with the context; see WithRequestID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by the context, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRequestID sends a request ID in the header, DefaultRequestIDHeader if header is "", to correlate the
+// call across services even when the trace is sampled out. The request ID is the one already in the header
+// of the request, or the one of the request context set with ContextWithRequestID, or a generated UUID.
+// It is the same for every attempt of a call, and is added to the logs and spans of the call.
+func WithRequestID(header string) Option {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	return func(cfg *config) {
+		cfg.requestIDHeader = header
+	}
+}
+
+// withRequestID returns the request with the request ID in the header and the context.
+func (cfg *config) withRequestID(req *http.Request) (*http.Request, error) {
+	if cfg.requestIDHeader == "" {
+		return req, nil
+	}
+	id := req.Header.Get(cfg.requestIDHeader)
+	if id == "" {
+		id = RequestIDFromContext(req.Context())
+	}
+	if id == "" {
+		var err error
+		if id, err = newUUID(); err != nil {
+			return nil, err
+		}
+	}
+	r := req.Clone(ContextWithRequestID(req.Context(), id))
+	r.Header.Set(cfg.requestIDHeader, id)
+	return r, nil
+}
@@ -0,0 +1,68 @@
+package httpClient
+
+import (
+	"os"
+	"path"
+	"sync"
+
+	"cloud.google.com/go/compute/metadata"
+	"contrib.go.opencensus.io/exporter/stackdriver"
+	"contrib.go.opencensus.io/exporter/stackdriver/monitoredresource"
+	"contrib.go.opencensus.io/exporter/stackdriver/monitoredresource/gcp"
+)
+
+// CloudRunRevision is the cloud_run_revision monitored resource of a Cloud Run service.
+type CloudRunRevision struct {
+	ProjectID         string
+	Location          string
+	ServiceName       string
+	RevisionName      string
+	ConfigurationName string
+}
+
+// MonitoredResource returns the type and labels of the resource.
+func (r *CloudRunRevision) MonitoredResource() (resType string, labels map[string]string) {
+	return "cloud_run_revision", map[string]string{
+		"project_id":         r.ProjectID,
+		"location":           r.Location,
+		"service_name":       r.ServiceName,
+		"revision_name":      r.RevisionName,
+		"configuration_name": r.ConfigurationName,
+	}
+}
+
+// DetectMonitoredResource returns the Cloud Monitoring monitored resource the program runs on: a
+// cloud_run_revision on Cloud Run, a gke_container on GKE or a gce_instance on Compute Engine. It is nil
+// elsewhere, and the exporter then records the metrics against the global resource.
+// The resource is detected once, from the environment and the metadata server.
+var DetectMonitoredResource = sync.OnceValue(detectMonitoredResource)
+
+func detectMonitoredResource() monitoredresource.Interface {
+	if service := os.Getenv("K_SERVICE"); service != "" && metadata.OnGCE() {
+		project, _ := metadata.ProjectID()
+		// The region is the full resource name, such as projects/123/regions/us-central1
+		region, _ := metadata.Get("instance/region")
+		return &CloudRunRevision{
+			ProjectID:         project,
+			Location:          path.Base(region),
+			ServiceName:       service,
+			RevisionName:      os.Getenv("K_REVISION"),
+			ConfigurationName: os.Getenv("K_CONFIGURATION"),
+		}
+	}
+	if r := gcp.Autodetect(); r != nil {
+		return r
+	}
+	return nil
+}
+
+// NewStackdriverExporter returns an exporter to Cloud Monitoring and Cloud Trace configured with the options,
+// and with the monitored resource of DetectMonitoredResource unless the options set one, so that the metrics
+// land on the Cloud Run revision, GKE container or Compute Engine instance that recorded them.
+// Register it with view.RegisterExporter and trace.RegisterExporter, and call Flush when the program exits.
+func NewStackdriverExporter(o stackdriver.Options) (*stackdriver.Exporter, error) {
+	if o.MonitoredResource == nil && o.Resource == nil && o.ResourceDetector == nil {
+		o.MonitoredResource = DetectMonitoredResource()
+	}
+	return stackdriver.NewExporter(o)
+}
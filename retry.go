@@ -0,0 +1,314 @@
+package httpClient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definition for the number of attempts made per call, including retries
+	outboundHTTPAttempts = stats.Int64("http_outbound_attempts", "Attempts per call to the external HTTP API, including retries", stats.UnitDimensionless)
+
+	// AttemptTag is the attempt number of the call recorded with the latency and counter metrics,
+	// starting at 1. Compare the metrics by attempt to see how many calls only succeeded after a retry.
+	AttemptTag = tag.MustNewKey("attempt")
+)
+
+func init() {
+	registerView(&view.View{
+		Measure:     outboundHTTPAttempts,
+		Name:        outboundHTTPAttempts.Name(),
+		TagKeys:     []tag.Key{APINameTag, VersionTag},
+		Description: outboundHTTPAttempts.Description(),
+		Aggregation: view.Distribution(0, 1, 2, 3, 4, 5, 6, 8, 10),
+	})
+}
+
+// RetryPolicy configures automatic retries of failed calls.
+// The delay before each retry grows exponentially from InitialBackoff by Multiplier,
+// capped at MaxBackoff, and is randomized between zero and that value ("full jitter")
+// so that many clients retrying at once don't hit the upstream in lockstep.
+// Every attempt is recorded in the metrics, tagged with the AttemptTag, and the number of
+// attempts per call is recorded in the http_outbound_attempts metric.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// A value of 0 or 1 turns retries off.
+	MaxAttempts int
+
+	// InitialBackoff is the upper bound of the delay before the first retry.
+	// Defaults to 100ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the upper bound of the delay before any retry.
+	// Defaults to 5s.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor the backoff grows by after each retry.
+	// Defaults to 2.
+	Multiplier float64
+
+	// Budget, if set, limits retries to a share of the request volume.
+	Budget *RetryBudget
+
+	// IsIdempotent reports whether the request can be retried safely.
+	// By default requests with an idempotent method (GET, HEAD, OPTIONS, TRACE, PUT, DELETE)
+	// or an Idempotency-Key header are retried; set IsIdempotent to change that for an API,
+	// for example to retry POSTs to an API known to be safe.
+	IsIdempotent func(req *http.Request) bool
+
+	// Retryable reports whether a failed attempt should be retried.
+	// Defaults to DefaultRetryPredicate.
+	Retryable RetryPredicate
+
+	// MaxBufferedBody is the largest request body, in bytes, that is buffered in memory so it can
+	// be sent again on a retry. Only bodies that can't be rewound with req.GetBody are buffered.
+	// Defaults to 1MB; a negative value turns buffering off.
+	MaxBufferedBody int64
+}
+
+// ErrBodyNotReplayable is returned when a call should be retried, but the request body
+// can't be sent again because it has no GetBody and was too large to buffer.
+var ErrBodyNotReplayable = errors.New("httpClient: request body can't be replayed for a retry")
+
+// WithRetry sets the retry policy. By default calls are not retried.
+// Which failures are retried is decided by RetryPolicy.Retryable, by default DefaultRetryPredicate:
+// errors from the HTTP call, and the status codes 429, 502, 503 and 504.
+// If a 429 or 503 response has a Retry-After header, the retry waits as long as the header
+// says instead of the backoff; if that is past the context deadline, the response is returned
+// without retrying.
+// Only idempotent requests are retried; see RetryPolicy.IsIdempotent and WithIdempotencyKey.
+// A request body is sent again on a retry using req.GetBody, which http.NewRequest sets up for
+// bytes.Buffer, bytes.Reader and strings.Reader bodies. Other bodies are buffered in memory,
+// up to RetryPolicy.MaxBufferedBody. If a retry is needed but the body can't be sent again,
+// the call fails with ErrBodyNotReplayable.
+func WithRetry(p RetryPolicy) Option {
+	return func(cfg *config) {
+		cfg.retry = p
+	}
+}
+
+// RetryPredicate reports whether an attempt that returned resp and err should be retried.
+// resp is nil if err is not nil.
+type RetryPredicate func(resp *http.Response, err error) bool
+
+// DefaultRetryPredicate retries on any error from the HTTP call, and on the status codes
+// 429 Too Many Requests, 502 Bad Gateway, 503 Service Unavailable and 504 Gateway Timeout.
+// Custom predicates can call it to extend the default, for example:
+//
+//	func(resp *http.Response, err error) bool {
+//		return DefaultRetryPredicate(resp, err) || (resp != nil && resp.StatusCode == http.StatusConflict)
+//	}
+func DefaultRetryPredicate(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return retryableStatus[resp.StatusCode]
+}
+
+// retryableStatus holds the status codes retried by default
+var retryableStatus = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// shouldRetry reports whether another attempt should be made after the attempt (starting at 1)
+// returned resp and err.
+func (p RetryPolicy) shouldRetry(attempt int, req *http.Request, resp *http.Response, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if req.Context().Err() != nil {
+		return false
+	}
+	idempotent := isIdempotent
+	if p.IsIdempotent != nil {
+		idempotent = p.IsIdempotent
+	}
+	if !idempotent(req) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(resp, err)
+	}
+	return DefaultRetryPredicate(resp, err)
+}
+
+// backoff returns the delay before the retry that follows the attempt (starting at 1).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = 5 * time.Second
+	}
+	mult := p.Multiplier
+	if mult <= 0 {
+		mult = 2
+	}
+
+	d := float64(initial) * math.Pow(mult, float64(attempt-1))
+	if d > float64(max) {
+		d = float64(max)
+	}
+	return time.Duration(randFloat64() * d)
+}
+
+// delay returns how long to wait before the retry that follows the attempt (starting at 1),
+// and false if the retry should not be made because the wait would end after the context deadline.
+func (p RetryPolicy) delay(ctx context.Context, attempt int, resp *http.Response) (time.Duration, bool) {
+	d := p.backoff(attempt)
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			d = after
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+		return 0, false
+	}
+	return d, true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds
+// or an HTTP date, and returns the time to wait from now.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// hasBody reports whether the request has a body.
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody
+}
+
+// bufferBody makes the body of the request replayable by buffering it in memory, if the request
+// may be sent more than once, or published as a dead letter, and the body can't already be rewound with req.GetBody.
+// A body larger than RetryPolicy.MaxBufferedBody is left as it is and can't be replayed.
+func (cfg *config) bufferBody(req *http.Request) (*http.Request, error) {
+	resend := cfg.retry.MaxAttempts > 1 || len(cfg.endpoints) > 1 || cfg.shadow != nil || cfg.refreshable() ||
+		cfg.deadLetter != nil
+	if !resend || !hasBody(req) || req.GetBody != nil {
+		return req, nil
+	}
+	limit := cfg.retry.MaxBufferedBody
+	if limit == 0 {
+		limit = 1 << 20
+	}
+	if limit < 0 {
+		return req, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: reading request body: %w", err)
+	}
+
+	r := req.Clone(req.Context())
+	if int64(len(buf)) > limit {
+		// Too large: send what was read followed by the rest, without a way to replay it
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+		return r, nil
+	}
+	req.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(buf))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	return r, nil
+}
+
+// rewind returns a copy of the request with a fresh body, ready to be sent again.
+// It returns ErrBodyNotReplayable if the body can't be rewound.
+func rewind(req *http.Request) (*http.Request, error) {
+	if !hasBody(req) {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, ErrBodyNotReplayable
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBodyNotReplayable, err)
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+// discard reads the rest of the response body, so the connection can be reused, and closes it.
+// At most 64KB is read; a longer body is not worth the wait.
+func discard(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	io.CopyN(io.Discard, resp.Body, 64<<10)
+	resp.Body.Close()
+}
+
+// sleep waits for the duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var (
+	randMu  sync.Mutex
+	randSrc = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// randFloat64 returns a pseudo-random number in [0.0,1.0) from a source that is safe for concurrent use.
+func randFloat64() float64 {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return randSrc.Float64()
+}
+
+// recordAttempts records the number of attempts made for a call.
+func recordAttempts(ctx context.Context, apiName string, versionName string, attempts int) error {
+	return stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(APINameTag, apiName), tag.Upsert(VersionTag, versionName)},
+		outboundHTTPAttempts.M(int64(attempts)))
+}
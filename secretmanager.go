@@ -0,0 +1,151 @@
+package httpClient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// DefaultSecretRefresh is how often a SecretManager refreshes the secrets when no interval is given.
+const DefaultSecretRefresh = 5 * time.Minute
+
+// SecretManager loads secrets, such as API keys, client certificates and HMAC keys, from Google Secret Manager,
+// so that they don't have to be put in environment variables or configuration files. The secrets are cached,
+// and refreshed in the background once they are older than the refresh interval, so that rotated secrets are
+// picked up without slowing the calls down. If a refresh fails, the cached secret is kept and the error logged.
+//
+// A SecretManager is safe for concurrent use by multiple goroutines.
+type SecretManager struct {
+	client  *Client
+	refresh time.Duration
+
+	mu      sync.Mutex
+	secrets map[string]*cachedSecret
+}
+
+// cachedSecret is the value of a secret and when it was loaded
+type cachedSecret struct {
+	mu         sync.Mutex
+	value      []byte
+	loaded     time.Time
+	refreshing bool
+}
+
+// NewSecretManager returns a SecretManager that refreshes the secrets every refresh (DefaultSecretRefresh if 0),
+// authenticated with the Application Default Credentials. The calls to Secret Manager are made with a Client
+// created with the options, such as WithLogger.
+func NewSecretManager(ctx context.Context, refresh time.Duration, opts ...Option) (*SecretManager, error) {
+	ts, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: finding credentials for Secret Manager: %w", err)
+	}
+	if refresh <= 0 {
+		refresh = DefaultSecretRefresh
+	}
+	opts = append([]Option{WithAPIName("secretmanager.versions.access"), WithTokenSource(ts)}, opts...)
+	return &SecretManager{client: New(opts...), refresh: refresh, secrets: map[string]*cachedSecret{}}, nil
+}
+
+// Get returns the secret version, such as "projects/my-project/secrets/partner-key/versions/3". Without a version,
+// the latest version is returned.
+func (m *SecretManager) Get(ctx context.Context, name string) ([]byte, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	m.mu.Lock()
+	s, ok := m.secrets[name]
+	if !ok {
+		s = &cachedSecret{}
+		m.secrets[name] = s
+	}
+	m.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value == nil {
+		value, err := m.access(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		s.value, s.loaded = value, time.Now()
+		return value, nil
+	}
+	if time.Since(s.loaded) > m.refresh && !s.refreshing {
+		s.refreshing = true
+		go m.refreshSecret(name, s)
+	}
+	return s.value, nil
+}
+
+// refreshSecret loads the secret again, keeping the cached value if that fails.
+func (m *SecretManager) refreshSecret(name string, s *cachedSecret) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	value, err := m.access(ctx, name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshing = false
+	if err != nil {
+		m.client.cfg.log().Warn("httpClient: refreshing secret", "secret", name, "error", err)
+		return
+	}
+	s.value, s.loaded = value, time.Now()
+}
+
+// access loads the secret version from Secret Manager, checking its checksum.
+func (m *SecretManager) access(ctx context.Context, name string) ([]byte, error) {
+	type response struct {
+		Payload struct {
+			Data       string `json:"data"`
+			DataCrc32c *int64 `json:"dataCrc32c,string"`
+		} `json:"payload"`
+	}
+	r, err := GetJSON[response](ctx, m.client, "https://secretmanager.googleapis.com/v1/"+name+":access")
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: accessing secret %s: %w", name, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(r.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: decoding secret %s: %w", name, err)
+	}
+	if r.Payload.DataCrc32c != nil && int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))) != *r.Payload.DataCrc32c {
+		return nil, fmt.Errorf("httpClient: secret %s is corrupt: checksum mismatch", name)
+	}
+	return data, nil
+}
+
+// Secret returns a SecretSource of the secret, such as for the Source of an APIKey or the Secret of an HMACConfig.
+func (m *SecretManager) Secret(name string) SecretSource {
+	return func(ctx context.Context) (string, error) {
+		b, err := m.Get(ctx, name)
+		return string(b), err
+	}
+}
+
+// ClientCertificate presents the client certificate and key in the PEM-encoded secrets to the host, or to every
+// host if host is "", like WithClientCertificate. The certificate is loaded again when the secrets are refreshed.
+func (m *SecretManager) ClientCertificate(host string, certSecret string, keySecret string) Option {
+	return withClientCertificateFunc(host, func(ctx context.Context) (*tls.Certificate, error) {
+		certPEM, err := m.Get(ctx, certSecret)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := m.Get(ctx, keySecret)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("httpClient: loading client certificate from %s: %w", certSecret, err)
+		}
+		return &cert, nil
+	})
+}
@@ -0,0 +1,146 @@
+package httpClient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// OpenCensus metric definition for the durations reported by the external HTTP API in Server-Timing headers
+	outboundHTTPServerTiming = stats.Float64("http_outbound_server_timing", "Time the external HTTP API reported spending on each part of the request in the Server-Timing header", stats.UnitMilliseconds)
+
+	// ServerTimingTag is the name of the Server-Timing entry recorded with the http_outbound_server_timing metric,
+	// such as "db" or "cache".
+	ServerTimingTag = tag.MustNewKey("server_timing")
+)
+
+func init() {
+	registerLatencyMetric(outboundHTTPServerTiming, []tag.Key{APINameTag, VersionTag, EndpointTag, ServerTimingTag})
+}
+
+// WithServerTimingMetrics records the durations of the entries of the Server-Timing headers of the responses
+// in the http_outbound_server_timing metric, tagged with the ServerTimingTag, to see the breakdown of where
+// the server spent its time. The entries are always added to the spans of the calls as events.
+//
+// The entry names are chosen by the server; use WithCardinalityLimit on the ServerTimingTag if they are unbounded.
+func WithServerTimingMetrics() Option {
+	return func(cfg *config) {
+		cfg.serverTiming = true
+	}
+}
+
+// serverTiming is an entry of a Server-Timing header
+type serverTiming struct {
+	name string
+	dur  time.Duration
+	desc string
+}
+
+// parseServerTiming returns the entries of the Server-Timing headers, such as
+//
+//	Server-Timing: cache;desc="Cache Read";dur=23.2, db;dur=53
+//
+// Entries without a name are skipped; entries without a duration have a duration of 0.
+func parseServerTiming(h http.Header) []serverTiming {
+	var timings []serverTiming
+	for _, header := range h.Values("Server-Timing") {
+		for _, entry := range splitQuoted(header, ',') {
+			params := splitQuoted(entry, ';')
+			t := serverTiming{name: strings.TrimSpace(params[0])}
+			if t.name == "" {
+				continue
+			}
+			for _, p := range params[1:] {
+				k, v, _ := strings.Cut(p, "=")
+				v = strings.TrimSpace(v)
+				if uq, err := strconv.Unquote(v); err == nil {
+					v = uq
+				}
+				switch strings.ToLower(strings.TrimSpace(k)) {
+				case "dur":
+					if ms, err := strconv.ParseFloat(v, 64); err == nil {
+						t.dur = time.Duration(ms * float64(time.Millisecond))
+					}
+				case "desc":
+					t.desc = v
+				}
+			}
+			timings = append(timings, t)
+		}
+	}
+	return timings
+}
+
+// splitQuoted splits s at sep, except within double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\' && quoted:
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// annotateServerTiming adds the Server-Timing entries to the spans of the request as events.
+func (p *phases) annotateServerTiming(timings []serverTiming) {
+	if len(timings) == 0 {
+		return
+	}
+	p.mu.Lock()
+	ocSpan, otelSpan := p.ocSpan, p.otelSpan
+	p.mu.Unlock()
+	for _, t := range timings {
+		ms := float64(t.dur.Microseconds()) / 1000
+		if ocSpan != nil {
+			ocSpan.Annotate([]trace.Attribute{
+				trace.Float64Attribute("duration_ms", ms),
+				trace.StringAttribute("description", t.desc),
+			}, "server_timing."+t.name)
+		}
+		if otelSpan != nil {
+			otelSpan.AddEvent("server_timing."+t.name, oteltrace.WithAttributes(
+				attribute.Float64("duration_ms", ms),
+				attribute.String("description", t.desc),
+			))
+		}
+	}
+}
+
+// recordServerTiming records the durations of the Server-Timing entries with the tags of the call,
+// applying the limits of WithCardinalityLimit on the ServerTimingTag.
+func (cl *call) recordServerTiming(ctx context.Context, mutators []tag.Mutator, timings []serverTiming) error {
+	var guards []tag.Mutator
+	for _, g := range cl.cfg.guards {
+		if g.key == ServerTimingTag {
+			guards = append(guards, g.mutator(cl.cfg.log()))
+		}
+	}
+	for _, t := range timings {
+		tags := append(mutators[:len(mutators):len(mutators)], tag.Upsert(ServerTimingTag, t.name))
+		err := stats.RecordWithTags(ctx, append(tags, guards...),
+			outboundHTTPServerTiming.M(float64(t.dur.Microseconds())/1000))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
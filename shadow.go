@@ -0,0 +1,86 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definition for shadow request latency
+	shadowHTTPLatency = stats.Int64("http_outbound_shadow_latency", "Latency of shadow requests mirrored to a secondary endpoint", stats.UnitMilliseconds)
+
+	// OpenCensus metric definition for shadow request count
+	shadowHTTPRequests = stats.Int64("http_outbound_shadow_count", "Count of shadow requests mirrored to a secondary endpoint", stats.UnitDimensionless)
+)
+
+func init() {
+	registerLatencyMetric(shadowHTTPLatency, []tag.Key{MethodTag, APINameTag, StatusTag, StatusClassTag, VersionTag, EndpointTag})
+	registerCounterMetric(shadowHTTPRequests, []tag.Key{MethodTag, APINameTag, StatusTag, StatusClassTag, VersionTag, EndpointTag})
+}
+
+// shadow is the configuration of traffic mirroring
+type shadow struct {
+	endpoint *endpoint
+	fraction float64
+}
+
+// WithShadow mirrors percent (0 to 100) of the requests to a secondary endpoint, for example to
+// validate a rewrite of a backend with production traffic. The shadow request is a copy of the
+// request, with the scheme and host (and base path, for relative URLs) of the endpoint. It is sent
+// in the background, with the same timeout as the call but not cancelled with it, and its response is discarded.
+// The latency and status of shadow requests are recorded separately from the regular metrics, in
+// http_outbound_shadow_latency and http_outbound_shadow_count.
+// Requests with a body are only mirrored if the body can be replayed; see RetryPolicy.MaxBufferedBody.
+// If the URL can't be parsed, Client.Do returns the error.
+func WithShadow(endpointURL string, percent float64) Option {
+	u, err := url.Parse(endpointURL)
+	return func(cfg *config) {
+		if err != nil {
+			cfg.err = fmt.Errorf("httpClient: invalid shadow endpoint: %w", err)
+			return
+		}
+		cfg.shadow = &shadow{endpoint: &endpoint{url: u, name: u.Host}, fraction: percent / 100}
+	}
+}
+
+// mirror sends a copy of the request to the shadow endpoint in the background, if the request is sampled.
+func (c *Client) mirror(req *http.Request, cfg *config) {
+	s := cfg.shadow
+	if s == nil || randFloat64() >= s.fraction {
+		return
+	}
+	if hasBody(req) && req.GetBody == nil {
+		return
+	}
+
+	r, err := rewind(req)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), cfg.timeout)
+	r = s.endpoint.apply(r.WithContext(ctx))
+	doer := cfg.newDoer()
+
+	go func() {
+		defer cancel()
+		start := time.Now()
+		// The shadow response is discarded; only its metrics matter
+		resp, err := doer.Do(r)
+		timeTaken := time.Since(start)
+		discard(resp)
+
+		if cfg.noMetrics {
+			return
+		}
+		mutators := httpMetricTags(r.Method, cfg.apiName, cfg.versionName, resp, err, append(cfg.tags[:len(cfg.tags):len(cfg.tags)], tag.Upsert(EndpointTag, s.endpoint.name)))
+		if err := stats.RecordWithTags(ctx, mutators, shadowHTTPLatency.M(timeTaken.Milliseconds()), shadowHTTPRequests.M(1)); err != nil {
+			cfg.log().Warn("httpClient: recording shadow request metrics failed", "api", cfg.apiName, "error", err)
+		}
+	}()
+}
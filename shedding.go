@@ -0,0 +1,195 @@
+package httpClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// ErrLoadShed is returned when a call was shed because the client was saturated
+// with calls of the same or higher priority.
+var ErrLoadShed = errors.New("httpClient: call shed because the client is saturated")
+
+var (
+	// OpenCensus metric definition for calls shed by the load shedder
+	loadShed = stats.Int64("http_outbound_shed_count", "Calls to the external HTTP API shed because the client was saturated", stats.UnitDimensionless)
+
+	// PriorityTag is the priority of a call, as set with WithPriority.
+	PriorityTag = tag.MustNewKey("priority")
+)
+
+func init() {
+	registerCounterMetric(loadShed, []tag.Key{APINameTag, PriorityTag})
+}
+
+// Priority is the priority of a call for the load shedder. Higher values are more important.
+type Priority int
+
+// Priorities of calls, from least to most important.
+const (
+	PriorityLow      Priority = -1
+	PriorityNormal   Priority = 0
+	PriorityHigh     Priority = 1
+	PriorityCritical Priority = 2
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	}
+	return strconv.Itoa(int(p))
+}
+
+// WithPriority sets the priority of the call for the load shedder set up with WithLoadShedding.
+// Calls have PriorityNormal by default.
+func WithPriority(p Priority) Option {
+	return func(cfg *config) {
+		cfg.priority = p
+	}
+}
+
+// WithLoadShedding limits the calls in flight for the client to maxInFlight, across all APIs.
+// Calls beyond that wait in a queue of up to maxQueue calls, ordered by priority, and get the
+// next free slot in order of priority. When the queue is full, the lowest-priority call is shed:
+// it fails immediately with ErrLoadShed. A new call is only let into a full queue if it has a
+// higher priority than a call already waiting.
+// A call holds its slot until Do returns, through all of its retries.
+// Pass the option to New: the queue is shared by every client created with the same Option value.
+// Shed calls are counted in the http_outbound_shed_count metric.
+// If maxInFlight is not positive, or maxQueue is negative, Client.Do returns an error.
+func WithLoadShedding(maxInFlight int, maxQueue int) Option {
+	if maxInFlight <= 0 || maxQueue < 0 {
+		return func(cfg *config) {
+			cfg.err = fmt.Errorf("httpClient: invalid load shedding of %d calls in flight and %d queued", maxInFlight, maxQueue)
+		}
+	}
+	s := &shedder{capacity: maxInFlight, maxQueue: maxQueue}
+	return func(cfg *config) {
+		cfg.shedder = s
+	}
+}
+
+// shedder is a priority queue of calls waiting for a slot
+type shedder struct {
+	capacity int
+	maxQueue int
+
+	mu       sync.Mutex
+	inFlight int
+	queue    []*waiter // in order of arrival
+}
+
+// waiter is a call waiting in the queue. The result is sent on ready: nil when the call
+// got a slot, or ErrLoadShed when it was shed.
+type waiter struct {
+	priority Priority
+	ready    chan error
+}
+
+// acquire waits for a slot. It fails with ErrLoadShed if the call is shed,
+// or with the context error if the context is done first.
+func (s *shedder) acquire(ctx context.Context, p Priority) error {
+	s.mu.Lock()
+	if s.inFlight < s.capacity {
+		s.inFlight++
+		s.mu.Unlock()
+		return nil
+	}
+
+	if len(s.queue) >= s.maxQueue {
+		lowest := s.lowest()
+		if lowest < 0 || s.queue[lowest].priority >= p {
+			s.mu.Unlock()
+			return ErrLoadShed
+		}
+		s.queue[lowest].ready <- ErrLoadShed
+		s.remove(lowest)
+	}
+
+	w := &waiter{priority: p, ready: make(chan error, 1)}
+	s.queue = append(s.queue, w)
+	s.mu.Unlock()
+
+	select {
+	case err := <-w.ready:
+		return err
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, q := range s.queue {
+			if q == w {
+				s.remove(i)
+				return ctx.Err()
+			}
+		}
+		// The waiter was handed a slot or shed just as the context was done
+		if err := <-w.ready; err == nil {
+			s.inFlight--
+			s.next()
+		}
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire and hands it to the highest-priority waiting call.
+func (s *shedder) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	s.next()
+}
+
+// next hands free slots to the highest-priority waiting calls, first come first served within a priority.
+// The caller must hold s.mu.
+func (s *shedder) next() {
+	for s.inFlight < s.capacity && len(s.queue) > 0 {
+		highest := 0
+		for i, w := range s.queue {
+			if w.priority > s.queue[highest].priority {
+				highest = i
+			}
+		}
+		s.inFlight++
+		s.queue[highest].ready <- nil
+		s.remove(highest)
+	}
+}
+
+// lowest returns the index of the lowest-priority waiting call, the latest to arrive within a priority,
+// or -1 if the queue is empty. The caller must hold s.mu.
+func (s *shedder) lowest() int {
+	lowest := -1
+	for i, w := range s.queue {
+		if lowest < 0 || w.priority <= s.queue[lowest].priority {
+			lowest = i
+		}
+	}
+	return lowest
+}
+
+// remove removes the waiting call at index i. The caller must hold s.mu.
+func (s *shedder) remove(i int) {
+	s.queue = append(s.queue[:i], s.queue[i+1:]...)
+}
+
+// recordShed records that a call was shed.
+func recordShed(ctx context.Context, apiName string, p Priority) error {
+	return stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(APINameTag, apiName),
+			tag.Upsert(PriorityTag, p.String()),
+		},
+		loadShed.M(1))
+}
@@ -0,0 +1,257 @@
+package httpClient
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSCredentials are the credentials of an AWS identity.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is set for temporary credentials, such as those of an assumed role.
+	SessionToken string
+}
+
+// AWSCredentialsFromEnv returns the credentials in the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables.
+func AWSCredentialsFromEnv(ctx context.Context) (AWSCredentials, error) {
+	c := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return c, fmt.Errorf("httpClient: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	return c, nil
+}
+
+// SigV4Config configures the signing of requests to AWS; see SigV4.
+type SigV4Config struct {
+	// Region is the AWS region of the API, such as "us-east-1".
+	Region string
+
+	// Service is the signing name of the AWS service, such as "s3" or "execute-api" for API Gateway.
+	Service string
+
+	// Credentials returns the credentials the requests are signed with. It is called for every request,
+	// so it should cache credentials that are expensive to get. Defaults to AWSCredentialsFromEnv.
+	Credentials func(ctx context.Context) (AWSCredentials, error)
+
+	// UnsignedPayload leaves the body out of the signature, so that it doesn't have to be read before the
+	// request is sent. Only some services, such as S3, accept unsigned payloads.
+	UnsignedPayload bool
+}
+
+// SigV4 returns middleware that signs the requests with AWS Signature Version 4, to call AWS APIs, such as S3 or
+// API Gateway with IAM authorization, with the metrics and tracing of the client:
+//
+//	client := httpClient.New(httpClient.WithMiddleware(httpClient.SigV4(httpClient.SigV4Config{
+//		Region:  "us-east-1",
+//		Service: "execute-api",
+//	})))
+//
+// The host, content type and X-Amz-* headers are signed. Unless UnsignedPayload is set, the body is read to be
+// hashed. To avoid copying it, use a body that can be read again, such as a bytes.Reader, or set WithRetry with
+// a RetryPolicy.MaxAttempts above 1, which buffers the bodies up to RetryPolicy.MaxBufferedBody so they can be.
+func SigV4(c SigV4Config) Middleware {
+	if c.Credentials == nil {
+		c.Credentials = AWSCredentialsFromEnv
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			creds, err := c.Credentials(req.Context())
+			if err != nil {
+				closeBody(req)
+				return nil, fmt.Errorf("httpClient: getting AWS credentials: %w", err)
+			}
+			signed, err := c.sign(req, creds, time.Now())
+			if err != nil {
+				closeBody(req)
+				return nil, err
+			}
+			return next.RoundTrip(signed)
+		})
+	}
+}
+
+// sign returns a copy of the request signed with the credentials at the time.
+func (c *SigV4Config) sign(req *http.Request, creds AWSCredentials, now time.Time) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	payloadHash := "UNSIGNED-PAYLOAD"
+	if !c.UnsignedPayload {
+		body, err := readBody(r)
+		if err != nil {
+			return nil, fmt.Errorf("httpClient: reading the body to sign: %w", err)
+		}
+		payloadHash = sha256Hex(body)
+	}
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	r.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	if c.Service == "s3" || c.UnsignedPayload {
+		r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	if r.URL.Scheme == "https" {
+		host = strings.TrimSuffix(host, ":443")
+	} else if r.URL.Scheme == "http" {
+		host = strings.TrimSuffix(host, ":80")
+	}
+
+	// The headers are signed in lower case, sorted by name
+	headers := map[string]string{"host": host}
+	for name, values := range r.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			headers[lower] = strings.Join(trimmed, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	path = awsEscape(path, false)
+	if c.Service != "s3" {
+		// Every service but S3 expects the path to be escaped twice
+		path = awsEscape(path, false)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		path,
+		canonicalQuery(r),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + c.Region + "/" + c.Service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, c.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+	return r, nil
+}
+
+// canonicalQuery returns the query of the request escaped and sorted by name and value.
+func canonicalQuery(r *http.Request) string {
+	var params []string
+	for name, values := range r.URL.Query() {
+		for _, v := range values {
+			params = append(params, awsEscape(name, true)+"="+awsEscape(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsEscape percent-encodes every byte of s but the unreserved characters of RFC 3986, and slashes
+// unless escapeSlash is set.
+func awsEscape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// readBody returns the body of the request, leaving the request with a body that can still be sent
+// and read again with GetBody.
+func readBody(r *http.Request) ([]byte, error) {
+	if !hasBody(r) || r.GetBody != nil {
+		return getBody(r)
+	}
+	b, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	return b, nil
+}
+
+// getBody returns the body of the request read with GetBody, without consuming it.
+func getBody(r *http.Request) ([]byte, error) {
+	if !hasBody(r) {
+		return nil, nil
+	}
+	if r.GetBody == nil {
+		return nil, errors.New("httpClient: the request body can't be read again")
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// closeBody closes the body of a request that won't be sent, as a RoundTripper must.
+func closeBody(r *http.Request) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,104 @@
+package httpClient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definition for request body size
+	outboundHTTPRequestBytes = stats.Int64("http_outbound_request_bytes", "Size of request bodies sent to the external HTTP API", stats.UnitBytes)
+
+	// OpenCensus metric definition for response body size
+	outboundHTTPResponseBytes = stats.Int64("http_outbound_response_bytes", "Size of response bodies received from the external HTTP API", stats.UnitBytes)
+)
+
+// DefaultSizeBuckets are the bucket boundaries, in bytes, of the body size distributions.
+var DefaultSizeBuckets = []float64{0, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+
+func init() {
+	registerSizeMetric(outboundHTTPRequestBytes, []tag.Key{MethodTag, APINameTag, StatusTag, StatusClassTag, VersionTag, EndpointTag})
+	registerSizeMetric(outboundHTTPResponseBytes, []tag.Key{MethodTag, APINameTag, StatusTag, StatusClassTag, VersionTag, EndpointTag})
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// countRequestBody returns the request with a body that counts the bytes sent, if the size of the
+// body is not known up front. The returned function returns the size of the body once the request is sent.
+func countRequestBody(req *http.Request) (*http.Request, func() int64) {
+	if !hasBody(req) {
+		return req, func() int64 { return 0 }
+	}
+	if req.ContentLength > 0 {
+		return req, func() int64 { return req.ContentLength }
+	}
+	counter := &countingReader{ReadCloser: req.Body}
+	r := req.Clone(req.Context())
+	r.Body = counter
+	return r, func() int64 { return counter.n }
+}
+
+// recordResponseBytes records the size of the response body, as counted by countResponseBytes.
+func recordResponseBytes(ctx context.Context, resp *http.Response, mutators []tag.Mutator, metricError func(error)) {
+	countResponseBytes(resp, func(n int64, returned bool) {
+		err := stats.RecordWithTags(ctx, mutators, outboundHTTPResponseBytes.M(n))
+		if returned {
+			// The call has returned by the time the body is read, so the error can only be ignored
+			return
+		}
+		metricError(err)
+	})
+}
+
+// countResponseBytes calls done with the size of the response body: right away from the Content-Length
+// if it is known, otherwise by counting the bytes as they are read, when the body is closed or fully read.
+// returned tells whether the call has returned by the time done is called.
+func countResponseBytes(resp *http.Response, done func(n int64, returned bool)) {
+	if resp == nil {
+		return
+	}
+	if resp.ContentLength >= 0 {
+		done(resp.ContentLength, false)
+		return
+	}
+	resp.Body = &countingBody{
+		countingReader: countingReader{ReadCloser: resp.Body},
+		done:           func(n int64) { done(n, true) },
+	}
+}
+
+// countingBody is a response body that reports the number of bytes read when it is fully read or closed
+type countingBody struct {
+	countingReader
+	once sync.Once
+	done func(n int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.countingReader.Read(p)
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.n) })
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.countingReader.Close()
+	b.once.Do(func() { b.done(b.n) })
+	return err
+}
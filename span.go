@@ -0,0 +1,206 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opencensus.io/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys of the span of a call, in addition to those of the OpenTelemetry semantic conventions.
+const (
+	URLTemplateAttribute = attribute.Key("url.template")
+	RetryCountAttribute  = attribute.Key("http.request.resend_count")
+	RequestIDAttribute   = attribute.Key("http.request_id")
+)
+
+// SpanNameFormatter returns the name of the spans of a call of the request to the API.
+// The default names the span of the call after the API name, or the URL path if there is no API name,
+// and the spans of the attempts after the URL path.
+type SpanNameFormatter func(req *http.Request, apiName string) string
+
+// WithSpanNameFormatter sets the function that names the spans of the call and of its attempts,
+// for example to avoid span names made of URLs with IDs in them:
+//
+//	WithSpanNameFormatter(func(req *http.Request, apiName string) string {
+//		return req.Method + " " + apiName
+//	})
+func WithSpanNameFormatter(f SpanNameFormatter) Option {
+	return func(cfg *config) {
+		cfg.spanName = f
+	}
+}
+
+// urlTemplateKey is the context key of the URL template the request was built from
+type urlTemplateKey struct{}
+
+// urlTemplate returns the URL template the request was built from with a RequestBuilder, or "".
+func urlTemplate(req *http.Request) string {
+	t, _ := req.Context().Value(urlTemplateKey{}).(string)
+	return t
+}
+
+// callSpan is the client span of a call, covering all its attempts, in OpenCensus and/or OpenTelemetry
+type callSpan struct {
+	oc   *trace.Span
+	otel oteltrace.Span
+}
+
+// startSpan starts the span of the call and returns the request with the span in its context,
+// so that the spans of the attempts are its children.
+func (cfg *config) startSpan(req *http.Request) (*http.Request, *callSpan) {
+	ctx := req.Context()
+	name := cfg.apiName
+	if cfg.spanName != nil {
+		name = cfg.spanName(req, cfg.apiName)
+	} else if name == "" {
+		name = req.URL.Path
+	}
+	sp := &callSpan{}
+	if cfg.openCensus() {
+		ctx, sp.oc = trace.StartSpan(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+		sp.oc.AddAttributes(
+			trace.StringAttribute("http.method", req.Method),
+			trace.StringAttribute("http.url", req.URL.Redacted()),
+			trace.StringAttribute("api_name", cfg.apiName),
+		)
+		if t := urlTemplate(req); t != "" {
+			sp.oc.AddAttributes(trace.StringAttribute("http.url_template", t))
+		}
+		if id := RequestIDFromContext(ctx); id != "" {
+			sp.oc.AddAttributes(trace.StringAttribute(string(RequestIDAttribute), id))
+		}
+	}
+	if cfg.openTelemetry() {
+		ctx, sp.otel = cfg.tracer().Start(ctx, name, oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+		sp.otel.SetAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.Redacted()),
+			APINameAttribute.String(cfg.apiName),
+		)
+		if t := urlTemplate(req); t != "" {
+			sp.otel.SetAttributes(URLTemplateAttribute.String(t))
+		}
+		if id := RequestIDFromContext(ctx); id != "" {
+			sp.otel.SetAttributes(RequestIDAttribute.String(id))
+		}
+	}
+	return req.WithContext(ctx), sp
+}
+
+// end ends the span of a call that made attempts and returned resp and err,
+// with the status decided by the SuccessPredicate.
+func (sp *callSpan) end(cfg *config, resp *http.Response, err error, attempts int) {
+	success := cfg.outcome(resp, err) == "success"
+	message := ""
+	switch {
+	case err != nil:
+		message = err.Error()
+	case !success:
+		message = resp.Status
+	}
+
+	if sp.oc != nil {
+		if attempts > 1 {
+			sp.oc.AddAttributes(trace.Int64Attribute("http.retry_count", int64(attempts-1)))
+		}
+		if resp != nil {
+			sp.oc.AddAttributes(trace.Int64Attribute("http.status_code", int64(resp.StatusCode)))
+			if resp.ContentLength >= 0 {
+				sp.oc.AddAttributes(trace.Int64Attribute("http.response_size", resp.ContentLength))
+			}
+		}
+		if success {
+			sp.oc.SetStatus(trace.Status{Code: trace.StatusCodeOK})
+		} else {
+			sp.oc.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: message})
+		}
+		sp.oc.End()
+	}
+
+	if sp.otel != nil {
+		if attempts > 1 {
+			sp.otel.SetAttributes(RetryCountAttribute.Int(attempts - 1))
+		}
+		if resp != nil {
+			sp.otel.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+			if resp.ContentLength >= 0 {
+				sp.otel.SetAttributes(semconv.HTTPResponseBodySize(int(resp.ContentLength)))
+			}
+		}
+		if success {
+			sp.otel.SetStatus(codes.Ok, "")
+		} else {
+			sp.otel.SetStatus(codes.Error, message)
+		}
+		sp.otel.End()
+	}
+}
+
+// tracer returns the OpenTelemetry tracer to use.
+func (cfg *config) tracer() oteltrace.Tracer {
+	tp := cfg.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(meterName)
+}
+
+// withURLTemplate returns ctx with the URL template the request is built from.
+func withURLTemplate(ctx context.Context, template string) context.Context {
+	return context.WithValue(ctx, urlTemplateKey{}, template)
+}
+
+// startAttempt starts the span of an attempt of the call, as a child of the span of the call, when the call
+// may be retried. The spans of the HTTP requests of the attempt are its children.
+func (cfg *config) startAttempt(req *http.Request, attempt int) (*http.Request, *callSpan) {
+	if cfg.retry.MaxAttempts <= 1 {
+		return req, nil
+	}
+	ctx := req.Context()
+	name := fmt.Sprintf("attempt %d", attempt)
+	sp := &callSpan{}
+	if cfg.openCensus() {
+		ctx, sp.oc = trace.StartSpan(ctx, name)
+		sp.oc.AddAttributes(trace.Int64Attribute("http.attempt", int64(attempt)))
+	}
+	if cfg.openTelemetry() {
+		ctx, sp.otel = cfg.tracer().Start(ctx, name)
+		sp.otel.SetAttributes(AttemptAttribute.Int(attempt))
+	}
+	return req.WithContext(ctx), sp
+}
+
+// retrying annotates the span of an attempt with the reason it failed and the delay before the next attempt.
+func (sp *callSpan) retrying(reason string, delay time.Duration) {
+	if sp == nil {
+		return
+	}
+	if sp.oc != nil {
+		sp.oc.Annotate([]trace.Attribute{
+			trace.StringAttribute("reason", reason),
+			trace.StringAttribute("backoff", delay.String()),
+		}, "retrying")
+	}
+	if sp.otel != nil {
+		sp.otel.AddEvent("retrying", oteltrace.WithAttributes(
+			attribute.String("reason", reason),
+			attribute.String("backoff", delay.String()),
+		))
+	}
+}
+
+// endAttempt ends the span of an attempt that returned resp and err.
+func (sp *callSpan) endAttempt(cfg *config, resp *http.Response, err error) {
+	if sp == nil {
+		return
+	}
+	sp.end(cfg, resp, err, 0)
+}
@@ -0,0 +1,94 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/tag"
+)
+
+// StatsD sends the latency and count of every call as DogStatsD metrics, for services that report
+// to Datadog rather than Cloud Monitoring. The metrics are named http_outbound.latency (a timer, in
+// milliseconds) and http_outbound.count (a counter), and tagged with the tags of the http_outbound_latency
+// view, including keys added with RegisterTagKeys.
+//
+// Create a StatsD with NewStatsD and pass it to WithStatsD.
+// A StatsD is safe for concurrent use by multiple goroutines.
+type StatsD struct {
+	prefix string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewStatsD returns a StatsD that sends the metrics over UDP to the DogStatsD agent at addr, such as "localhost:8125".
+// The prefix, if not empty, is prefixed to the metric names, as in myservice.http_outbound.latency.
+func NewStatsD(addr string, prefix string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: connecting to statsd: %w", err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &StatsD{prefix: prefix, conn: conn}, nil
+}
+
+// Close closes the connection to the agent.
+func (s *StatsD) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
+
+// WithStatsD sends the latency and count of every call to DogStatsD, in addition to the metrics
+// selected with WithTelemetry.
+func WithStatsD(s *StatsD) Option {
+	return func(cfg *config) {
+		cfg.statsd = s
+	}
+}
+
+// record sends the latency and count of a call, with the tags set by the mutators.
+func (s *StatsD) record(ctx context.Context, mutators []tag.Mutator, latency time.Duration) error {
+	ctx, err := tag.New(ctx, mutators...)
+	if err != nil {
+		return err
+	}
+	tags := statsdTags(tag.FromContext(ctx))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%shttp_outbound.latency:%d|ms%s\n", s.prefix, latency.Milliseconds(), tags)
+	fmt.Fprintf(&b, "%shttp_outbound.count:1|c%s", s.prefix, tags)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.conn.Write([]byte(b.String()))
+	return err
+}
+
+// statsdTags returns the DogStatsD tag suffix, such as "|#api_name:books,http_method:GET",
+// for the keys of the latency view that are set in the map.
+func statsdTags(m *tag.Map) string {
+	viewsMu.Lock()
+	keys := views[outboundHTTPLatency.Name()].TagKeys
+	viewsMu.Unlock()
+
+	var tags []string
+	for _, k := range keys {
+		if v, ok := m.Value(k); ok && v != "" {
+			tags = append(tags, k.Name()+":"+statsdEscape(v))
+		}
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// statsdEscape replaces the characters that separate the parts of a DogStatsD metric.
+var statsdEscape = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_").Replace
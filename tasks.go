@@ -0,0 +1,158 @@
+package httpClient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// TaskNameHeader is the header of the responses of a TaskQueue that carries the name of the created task.
+const TaskNameHeader = "X-Cloud-Task-Name"
+
+// TaskQueueConfig configures a TaskQueue.
+type TaskQueueConfig struct {
+	// Queue is the name of the Cloud Tasks queue, such as "projects/my-project/locations/us-central1/queues/webhooks".
+	// The rate of delivery and the retries are set on the queue.
+	Queue string
+
+	// ServiceAccount, if set, is the email of the service account whose OIDC token Cloud Tasks sends with the
+	// requests, such as to call a Cloud Run service. The token is minted when the request is delivered, so it
+	// doesn't expire while the task waits in the queue. The Authorization header of the requests is dropped.
+	ServiceAccount string
+
+	// Audience is the audience of the OIDC token. Defaults to the URL of the request.
+	Audience string
+
+	// DispatchDeadline is how long Cloud Tasks waits for the response to a request. Defaults to 10 minutes.
+	DispatchDeadline time.Duration
+}
+
+// TaskQueue is a transport that, instead of calling the endpoint, enqueues the request into Cloud Tasks, which
+// delivers it, retrying until it succeeds, at the rate set on the queue. The request survives the process
+// crashing once it is enqueued. Use it as the transport of the clients of webhook-style APIs, whose responses
+// aren't needed:
+//
+//	queue, err := httpClient.NewTaskQueue(ctx, httpClient.TaskQueueConfig{
+//		Queue: "projects/my-project/locations/us-central1/queues/webhooks",
+//	})
+//	...
+//	client := httpClient.New(httpClient.WithAPIName("partner.webhook"), httpClient.WithTransport(queue))
+//
+// The request is enqueued with its headers, including those added by the client, such as the trace context,
+// the request ID and the credentials, and its body. Credentials that expire, such as tokens and HMAC signatures,
+// may have expired by the time the request is delivered; prefer TaskQueueConfig.ServiceAccount.
+// The response is 202 Accepted, with the name of the task in the TaskNameHeader, and the metrics and spans of
+// the call are those of enqueuing it. A request with an IdempotencyKeyHeader is enqueued at most once per
+// key: Cloud Tasks rejects the tasks whose name was used in the last hour, and the duplicates are reported as
+// accepted.
+//
+// A TaskQueue is safe for concurrent use by multiple goroutines.
+type TaskQueue struct {
+	client *Client
+	cfg    TaskQueueConfig
+}
+
+// NewTaskQueue returns a TaskQueue that enqueues the requests into the queue, authenticated with the Application
+// Default Credentials. The calls to Cloud Tasks are made with a Client created with the options, such as WithLogger.
+func NewTaskQueue(ctx context.Context, c TaskQueueConfig, opts ...Option) (*TaskQueue, error) {
+	ts, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: finding credentials for Cloud Tasks: %w", err)
+	}
+	if c.DispatchDeadline <= 0 {
+		c.DispatchDeadline = 10 * time.Minute
+	}
+	opts = append([]Option{WithAPIName("cloudtasks.tasks.create"), WithTokenSource(ts)}, opts...)
+	return &TaskQueue{client: New(opts...), cfg: c}, nil
+}
+
+// cloudTask is the Task resource of the Cloud Tasks API
+type cloudTask struct {
+	Name        string `json:"name,omitempty"`
+	HTTPRequest struct {
+		URL        string            `json:"url"`
+		HTTPMethod string            `json:"httpMethod"`
+		Headers    map[string]string `json:"headers,omitempty"`
+		Body       string            `json:"body,omitempty"`
+		OIDCToken  *taskOIDCToken    `json:"oidcToken,omitempty"`
+	} `json:"httpRequest"`
+	DispatchDeadline string `json:"dispatchDeadline,omitempty"`
+}
+
+// taskOIDCToken is the OidcToken of the HttpRequest of a task
+type taskOIDCToken struct {
+	ServiceAccountEmail string `json:"serviceAccountEmail"`
+	Audience            string `json:"audience,omitempty"`
+}
+
+// taskIDChars matches the characters not allowed in a task ID
+var taskIDChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// RoundTrip enqueues the request.
+func (q *TaskQueue) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("httpClient: reading the body to enqueue: %w", err)
+		}
+		body = b
+	}
+
+	var t cloudTask
+	t.HTTPRequest.URL = req.URL.String()
+	t.HTTPRequest.HTTPMethod = req.Method
+	t.HTTPRequest.Body = base64.StdEncoding.EncodeToString(body)
+	t.DispatchDeadline = fmt.Sprintf("%ds", int(q.cfg.DispatchDeadline.Seconds()))
+	t.HTTPRequest.Headers = map[string]string{}
+	for name, values := range req.Header {
+		// Cloud Tasks sets the hop-by-hop headers, and the OIDC token replaces the Authorization header
+		if name == "Host" || name == "Content-Length" || name == "Connection" ||
+			(name == "Authorization" && q.cfg.ServiceAccount != "") {
+			continue
+		}
+		t.HTTPRequest.Headers[name] = strings.Join(values, ", ")
+	}
+	if q.cfg.ServiceAccount != "" {
+		t.HTTPRequest.OIDCToken = &taskOIDCToken{ServiceAccountEmail: q.cfg.ServiceAccount, Audience: q.cfg.Audience}
+	}
+	if key := req.Header.Get(IdempotencyKeyHeader); key != "" {
+		t.Name = q.cfg.Queue + "/tasks/" + taskIDChars.ReplaceAllString(key, "_")
+	}
+
+	u := "https://cloudtasks.googleapis.com/v2/" + q.cfg.Queue + "/tasks"
+	created, err := PostJSON[cloudTask](req.Context(), q.client, u, map[string]any{"task": t})
+	var se *StatusError
+	switch {
+	case err == nil:
+	case errors.As(err, &se) && se.StatusCode == http.StatusConflict && t.Name != "":
+		// The request was already enqueued with the key
+		created.Name = t.Name
+	case errors.Is(err, ErrMetricRecord) && !errors.Is(err, ErrHTTP):
+		// The task was created, only its metrics were not recorded
+	default:
+		return nil, fmt.Errorf("httpClient: enqueuing the request: %w", err)
+	}
+
+	return &http.Response{
+		Status:        "202 Accepted",
+		StatusCode:    http.StatusAccepted,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{TaskNameHeader: {created.Name}},
+		Body:          io.NopCloser(bytes.NewReader(nil)),
+		ContentLength: 0,
+		Request:       req,
+	}, nil
+}
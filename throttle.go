@@ -0,0 +1,151 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// OpenCensus metric definition for the remaining quota reported by the API
+	rateLimitRemaining = stats.Int64("http_outbound_ratelimit_remaining", "Remaining request quota reported by the external HTTP API", stats.UnitDimensionless)
+)
+
+func init() {
+	registerGaugeMetric(rateLimitRemaining, []tag.Key{APINameTag})
+}
+
+// rateLimitHeaders lists the (remaining, reset) header pairs recognized by the adaptive throttle:
+// the common X-RateLimit headers (also used by GitHub), and the IETF RateLimit headers.
+var rateLimitHeaders = [][2]string{
+	{"X-RateLimit-Remaining", "X-RateLimit-Reset"},
+	{"RateLimit-Remaining", "RateLimit-Reset"},
+	{"X-Rate-Limit-Remaining", "X-Rate-Limit-Reset"},
+}
+
+// WithAdaptiveThrottling slows down calls to an API as its quota runs out, based on the
+// rate limit headers of its responses (X-RateLimit-Remaining and X-RateLimit-Reset, or the
+// IETF RateLimit-Remaining and RateLimit-Reset). Once fewer than minRemaining calls remain,
+// the remaining calls are spread evenly until the quota resets; when the quota is used up,
+// calls wait for the reset. A call that would have to wait past its context deadline fails
+// right away with an error wrapping context.DeadlineExceeded.
+// The reset header may be a Unix time or a number of seconds.
+// Throttles are kept per API name. Pass the option to New: the throttles are shared by every
+// client created with the same Option value.
+// The remaining quota is recorded in the http_outbound_ratelimit_remaining metric.
+func WithAdaptiveThrottling(minRemaining int) Option {
+	throttles := newKeyed(func(key string) *throttle {
+		return &throttle{apiName: key, minRemaining: minRemaining}
+	})
+	return func(cfg *config) {
+		cfg.throttles = throttles
+	}
+}
+
+// throttle tracks the quota of one API
+type throttle struct {
+	apiName      string
+	minRemaining int
+
+	mu        sync.Mutex
+	known     bool // whether a response has reported the quota
+	remaining int
+	reset     time.Time
+	next      time.Time // earliest time the next call may be made
+}
+
+// wait waits until a call may be made according to the quota.
+func (t *throttle) wait(ctx context.Context) error {
+	t.mu.Lock()
+	now := time.Now()
+	var at time.Time
+	switch {
+	case !t.known || !now.Before(t.reset):
+		// Nothing known about the quota, or it has reset
+	case t.remaining <= 0:
+		at = t.reset
+	case t.remaining < t.minRemaining:
+		// Spread the remaining calls evenly until the reset
+		interval := t.reset.Sub(now) / time.Duration(t.remaining)
+		at = t.next
+		if at.Before(now) {
+			at = now
+		}
+		t.next = at.Add(interval)
+	}
+	t.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+		return fmt.Errorf("httpClient: API quota exhausted until %v: %w", at.Format(time.RFC3339), context.DeadlineExceeded)
+	}
+	return sleep(ctx, d)
+}
+
+// update reads the quota from the response headers. It returns false if the response had no quota headers.
+func (t *throttle) update(resp *http.Response) (remaining int, ok bool) {
+	if resp == nil {
+		return 0, false
+	}
+	for _, h := range rateLimitHeaders {
+		remaining, err := strconv.Atoi(strings.TrimSpace(resp.Header.Get(h[0])))
+		if err != nil {
+			continue
+		}
+		reset, ok := parseReset(resp.Header.Get(h[1]), time.Now())
+		if !ok {
+			continue
+		}
+
+		t.mu.Lock()
+		t.known, t.remaining, t.reset = true, remaining, reset
+		t.mu.Unlock()
+		return remaining, true
+	}
+	return 0, false
+}
+
+// parseReset parses a rate limit reset header, which is either a Unix time in seconds
+// or a number of seconds from now.
+func parseReset(v string, now time.Time) (time.Time, bool) {
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	// A delta of more than a year makes no sense, so larger values are Unix times
+	if n > 365*24*60*60 {
+		return time.Unix(n, 0), true
+	}
+	return now.Add(time.Duration(n) * time.Second), true
+}
+
+// waitThrottle waits until the throttle of the API lets the call through.
+func (cl *call) waitThrottle(ctx context.Context) error {
+	if cl.cfg.throttles == nil {
+		return nil
+	}
+	return cl.cfg.throttles.get(cl.cfg.apiName).wait(ctx)
+}
+
+// updateThrottle updates the throttle of the API from the response, and records the remaining quota.
+func (cl *call) updateThrottle(ctx context.Context, resp *http.Response) {
+	if cl.cfg.throttles == nil {
+		return
+	}
+	remaining, ok := cl.cfg.throttles.get(cl.cfg.apiName).update(resp)
+	if ok && !cl.cfg.noMetrics {
+		cl.metricError(stats.RecordWithTags(ctx,
+			[]tag.Mutator{tag.Upsert(APINameTag, cl.cfg.apiName)},
+			rateLimitRemaining.M(int64(remaining))))
+	}
+}
@@ -0,0 +1,31 @@
+package httpClient
+
+import (
+	"fmt"
+
+	"contrib.go.opencensus.io/exporter/stackdriver"
+	"go.opencensus.io/trace"
+)
+
+// SetupTracing exports the OpenCensus traces of the program to Cloud Trace in the project, sampling
+// the fraction of the traces started by the program (traces started upstream follow the upstream decision).
+// Call the returned function when the program exits, to send the spans that haven't been exported yet:
+//
+//	stop, err := httpClient.SetupTracing("my-project", 0.1)
+//	if err != nil {
+//		...
+//	}
+//	defer stop()
+func SetupTracing(projectID string, sampleFraction float64) (stop func(), err error) {
+	exporter, err := NewStackdriverExporter(stackdriver.Options{ProjectID: projectID})
+	if err != nil {
+		return nil, fmt.Errorf("httpClient: creating Cloud Trace exporter: %w", err)
+	}
+	trace.RegisterExporter(exporter)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(sampleFraction)})
+
+	return func() {
+		trace.UnregisterExporter(exporter)
+		exporter.Flush()
+	}, nil
+}
@@ -0,0 +1,284 @@
+package httpClient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+)
+
+// Protocol is the version of HTTP spoken by a transport created by WithTransportConfig.
+type Protocol int
+
+const (
+	// ProtocolAuto uses HTTP/2 with the hosts that negotiate it over TLS, and HTTP/1.1 otherwise,
+	// like http.DefaultTransport.
+	ProtocolAuto Protocol = iota
+
+	// ProtocolHTTP1 uses HTTP/1.1 only, such as for APIs whose HTTP/2 support is broken.
+	ProtocolHTTP1
+
+	// ProtocolHTTP2 uses HTTP/2 only; the calls to http URLs, or to hosts that don't negotiate HTTP/2 over TLS,
+	// fail. The calls to a host are multiplexed over a connection, so the limits on idle connections hardly apply.
+	ProtocolHTTP2
+
+	// ProtocolH2C uses HTTP/2 over cleartext TCP with prior knowledge (h2c) for the http URLs, such as for
+	// internal services behind an L4 load balancer that speak HTTP/2 without TLS, and ProtocolAuto for the
+	// https URLs. The h2c connections only take DisableCompression from the transport: the other fields of the
+	// TransportConfig don't apply to them.
+	ProtocolH2C
+
+	// ProtocolHTTP3 uses HTTP/3 over QUIC for the https URLs, such as for latency-sensitive calls to CDNs and
+	// Google front ends, and ProtocolAuto for the http URLs. If the QUIC connection to a host can't be made,
+	// such as when UDP is blocked, the call falls back to HTTP/2 or HTTP/1.1, and so do the calls to the host
+	// for the next 5 minutes. The HTTP/3 connections only take DisableCompression and the TLS configuration
+	// from the transport. HTTP/3 support is experimental.
+	ProtocolHTTP3
+)
+
+const (
+	// http3HandshakeTimeout is how long the QUIC handshake may take before the call falls back to TCP
+	http3HandshakeTimeout = 3 * time.Second
+
+	// http3Backoff is how long the calls to a host use TCP after a QUIC connection to it failed
+	http3Backoff = 5 * time.Minute
+)
+
+// TransportConfig configures the connection pool and the protocol of the transport created by WithTransportConfig.
+// The zero value of a field keeps the value of http.DefaultTransport, unless noted.
+type TransportConfig struct {
+	// MaxIdleConns is the number of idle connections kept open, across every host. Defaults to 100.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost is the number of idle connections kept open to each host. Defaults to MaxIdleConns,
+	// as the clients of an API mostly call one host; net/http keeps 2, which makes a client with more than
+	// 2 concurrent calls open and close connections all the time.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost limits the connections to each host, idle or in use; the calls beyond the limit wait
+	// for a connection. 0 means no limit.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept open. Defaults to 90 seconds.
+	IdleConnTimeout time.Duration
+
+	// DisableKeepAlives uses a new connection for every call.
+	DisableKeepAlives bool
+
+	// ResponseHeaderTimeout, if set, is how long to wait for the headers of the response once the request is
+	// sent, to fail fast on an API that accepts connections but doesn't answer, within the timeout of the call.
+	ResponseHeaderTimeout time.Duration
+
+	// Protocol is the version of HTTP of the calls. Defaults to ProtocolAuto. The version of each call is
+	// recorded in the ProtocolTag.
+	Protocol Protocol
+
+	// DialContext, if set, opens the TCP connections in place of a net.Dialer, such as to go through a VPC
+	// connector or a test network namespace, or to inject latency. The time it takes is recorded in the
+	// http_outbound_connect_latency metric and the connect_done span event, like that of a net.Dialer.
+	// The TLS handshake is still done by the transport. It doesn't apply to the QUIC connections of ProtocolHTTP3.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// WithTransportConfig sends the calls with a copy of http.DefaultTransport configured with c, in place of the
+// transport set with WithTransport. Pass the option to New: the connections are pooled across every client
+// created with the same Option value.
+func WithTransportConfig(c TransportConfig) Option {
+	t, err := c.newTransport()
+	if err != nil {
+		return func(cfg *config) {
+			cfg.err = fmt.Errorf("httpClient: configuring the transport: %w", err)
+		}
+	}
+	return func(cfg *config) {
+		cfg.transport = t
+	}
+}
+
+// newTransport returns a copy of http.DefaultTransport configured with c.
+func (c TransportConfig) newTransport() (http.RoundTripper, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if c.MaxIdleConns > 0 {
+		t.MaxIdleConns = c.MaxIdleConns
+	}
+	t.MaxIdleConnsPerHost = t.MaxIdleConns
+	if c.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	t.MaxConnsPerHost = c.MaxConnsPerHost
+	if c.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = c.IdleConnTimeout
+	}
+	t.DisableKeepAlives = c.DisableKeepAlives
+	t.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+	if c.DialContext != nil {
+		t.DialContext = tracedDial(c.DialContext)
+	}
+
+	switch c.Protocol {
+	case ProtocolHTTP1:
+		// A non-nil empty map turns HTTP/2 off
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		t.TLSClientConfig = tlsConfig(t, "http/1.1")
+	case ProtocolHTTP2:
+		if _, err := http2.ConfigureTransports(t); err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = tlsConfig(t, "h2")
+		t.DialTLSContext = dialHTTP2(t)
+		return &http2Transport{base: t}, nil
+	case ProtocolH2C:
+		h2c := &http2.Transport{
+			AllowHTTP:          true,
+			DisableCompression: t.DisableCompression,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return t.DialContext(ctx, network, addr)
+			},
+		}
+		return &http2Transport{base: t, h2c: h2c}, nil
+	case ProtocolHTTP3:
+		h3 := &http3.RoundTripper{
+			TLSClientConfig:    t.TLSClientConfig,
+			QUICConfig:         &quic.Config{HandshakeIdleTimeout: http3HandshakeTimeout},
+			DisableCompression: t.DisableCompression,
+			Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+				conn, err := quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+				if err != nil {
+					return nil, &quicDialError{err: err}
+				}
+				return conn, nil
+			},
+		}
+		return &http3Transport{base: t, h3: h3, failed: map[string]time.Time{}}, nil
+	}
+	return t, nil
+}
+
+// tracedDial returns the dial function calling the ConnectStart and ConnectDone httptrace hooks around dial,
+// which a net.Dialer calls itself, so that the phases of the calls are recorded whatever the dialer.
+// The phases keep the first time of each hook, so a dial function using a net.Dialer is recorded once.
+func tracedDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ct := httptrace.ContextClientTrace(ctx)
+		if ct != nil && ct.ConnectStart != nil {
+			ct.ConnectStart(network, addr)
+		}
+		conn, err := dial(ctx, network, addr)
+		if ct != nil && ct.ConnectDone != nil {
+			ct.ConnectDone(network, addr, err)
+		}
+		return conn, err
+	}
+}
+
+// tlsConfig returns a copy of the TLS configuration of the transport that negotiates the protocol only.
+func tlsConfig(t *http.Transport, protocol string) *tls.Config {
+	c := &tls.Config{}
+	if t.TLSClientConfig != nil {
+		c = t.TLSClientConfig.Clone()
+	}
+	c.NextProtos = []string{protocol}
+	return c
+}
+
+// dialHTTP2 returns a function that opens TLS connections with the dialer and TLS configuration of the
+// transport, failing if the host doesn't negotiate HTTP/2, so that the transport never falls back to HTTP/1.1.
+func dialHTTP2(t *http.Transport) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := t.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		c := t.TLSClientConfig.Clone()
+		if c.ServerName == "" {
+			c.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tc := tls.Client(conn, c)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if p := tc.ConnectionState().NegotiatedProtocol; p != "h2" {
+			tc.Close()
+			return nil, fmt.Errorf("httpClient: %s doesn't support HTTP/2", addr)
+		}
+		return tc, nil
+	}
+}
+
+// http2Transport sends the requests to https URLs with base, and those to http URLs with HTTP/2 over cleartext
+// TCP with h2c, or fails them if h2c is nil
+type http2Transport struct {
+	base *http.Transport
+	h2c  *http2.Transport
+}
+
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" {
+		return t.base.RoundTrip(req)
+	}
+	if t.h2c == nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, errors.New("httpClient: HTTP/2 over cleartext TCP needs ProtocolH2C")
+	}
+	return t.h2c.RoundTrip(req)
+}
+
+// http3Transport sends the requests to https URLs with HTTP/3, and the others, as well as those to the hosts
+// it couldn't connect to with QUIC lately, with base
+type http3Transport struct {
+	base *http.Transport
+	h3   *http3.RoundTripper
+
+	mu     sync.Mutex
+	failed map[string]time.Time
+}
+
+// quicDialError is the error of a QUIC connection that couldn't be made, before the request was sent
+type quicDialError struct {
+	err error
+}
+
+func (e *quicDialError) Error() string { return e.err.Error() }
+func (e *quicDialError) Unwrap() error { return e.err }
+
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if req.URL.Scheme != "https" || t.backingOff(host) {
+		return t.base.RoundTrip(req)
+	}
+	resp, err := t.h3.RoundTrip(req)
+	var dialErr *quicDialError
+	if err == nil || !errors.As(err, &dialErr) || req.Context().Err() != nil {
+		return resp, err
+	}
+	// The request wasn't sent, so it can be sent over TCP
+	t.mu.Lock()
+	t.failed[host] = time.Now()
+	t.mu.Unlock()
+	return t.base.RoundTrip(req)
+}
+
+// backingOff reports whether a QUIC connection to the host failed less than http3Backoff ago.
+func (t *http3Transport) backingOff(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	failed, ok := t.failed[host]
+	if ok && time.Since(failed) >= http3Backoff {
+		delete(t.failed, host)
+		return false
+	}
+	return ok
+}
@@ -0,0 +1,42 @@
+package httpClient
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// resolveURL returns ref resolved against base. Unlike url.ResolveReference, the path
+// of base is kept as a prefix, so base https://host/api and ref /v1/books give https://host/api/v1/books.
+// If ref is already absolute, it is returned unchanged.
+func resolveURL(base *url.URL, ref *url.URL) *url.URL {
+	if base == nil || ref.IsAbs() || ref.Host != "" {
+		return ref
+	}
+	u := *base
+	if ref.Path != "" {
+		u.Path = joinPath(base.Path, ref.Path)
+		u.RawPath = joinPath(base.EscapedPath(), ref.EscapedPath())
+	}
+	u.RawQuery = ref.RawQuery
+	u.Fragment = ref.Fragment
+	return &u
+}
+
+// joinPath joins two URL paths with exactly one slash between them.
+func joinPath(a string, b string) string {
+	return strings.TrimSuffix(a, "/") + "/" + strings.TrimPrefix(b, "/")
+}
+
+// withBaseURL returns the request with its URL resolved against base.
+// The request is only copied if the URL changes.
+func withBaseURL(req *http.Request, base *url.URL) *http.Request {
+	u := resolveURL(base, req.URL)
+	if u == req.URL {
+		return req
+	}
+	r := req.Clone(req.Context())
+	r.URL = u
+	r.Host = ""
+	return r
+}
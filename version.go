@@ -0,0 +1,40 @@
+package httpClient
+
+import (
+	"os"
+	"path"
+	"sync"
+
+	"cloud.google.com/go/compute/metadata"
+)
+
+// DetectedVersion returns the value of the VersionTag recorded by clients created without WithVersion.
+// It is detected once, the first time it is needed:
+//
+//   - on Cloud Run, it is the revision name, from the K_REVISION environment variable, or the service name,
+//     from K_SERVICE, if the revision is not set
+//   - on Compute Engine, it is the name of the instance template of the managed instance group,
+//     from the metadata server
+//
+// Elsewhere, it is empty. The metadata server is only asked when the environment variables are not set,
+// which may take a moment outside of Google Cloud.
+var DetectedVersion = sync.OnceValue(detectVersion)
+
+func detectVersion() string {
+	if v := os.Getenv("K_REVISION"); v != "" {
+		return v
+	}
+	if v := os.Getenv("K_SERVICE"); v != "" {
+		return v
+	}
+	if !metadata.OnGCE() {
+		return ""
+	}
+	// The attribute is the full resource name of the template, such as
+	// projects/123/global/instanceTemplates/books-v2
+	t, err := metadata.InstanceAttributeValue("instance-template")
+	if err != nil {
+		return ""
+	}
+	return path.Base(t)
+}